@@ -10,14 +10,17 @@ import (
 	"syscall"
 	"time"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/user/llm-gateway/internal/admin"
 	"github.com/user/llm-gateway/internal/config"
+	"github.com/user/llm-gateway/internal/health"
 	"github.com/user/llm-gateway/internal/middleware"
 	"github.com/user/llm-gateway/internal/proxy"
 	"github.com/user/llm-gateway/internal/store"
 	"github.com/user/llm-gateway/internal/telemetry"
+	"github.com/user/llm-gateway/internal/tokenizer"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
@@ -49,6 +52,12 @@ func main() {
 
 	rlStore := store.NewRedisRateLimitStore(cfg.RedisAddr, cfg.RedisPassword)
 
+	// AWS credentials (task role) for SigV4-signed Bedrock calls
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.AWSRegion))
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+
 	// Initialize Telemetry (OpenTelemetry)
 	tpShutdown, err := telemetry.InitTracer()
 	if err != nil {
@@ -63,7 +72,23 @@ func main() {
 	}
 
 	// Initialize Handler
-	proxyHandler := proxy.NewHandler(rlStore, modelStore, usageStore, cfg.LLMTimeout)
+	proxyOpts := []proxy.Option{
+		proxy.WithTokenizers(tokenizer.NewRegistry(cfg.TokenizerDir)),
+		proxy.WithAWSConfig(awsCfg),
+	}
+	var adminOpts []admin.Option
+
+	// Active Health Checks (stopped on shutdown)
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	if cfg.HealthCheckInterval > 0 {
+		checker := health.NewChecker(modelStore, cfg.HealthCheckInterval)
+		checker.Start(healthCtx)
+		proxyOpts = append(proxyOpts, proxy.WithHealthChecker(checker))
+		adminOpts = append(adminOpts, admin.WithHealthChecker(checker))
+	}
+
+	proxyHandler := proxy.NewHandler(rlStore, modelStore, usageStore, cfg.LLMTimeout, proxyOpts...)
 
 	// Register Middleware
 	r.Use(otelgin.Middleware("llm-gateway"))
@@ -72,13 +97,19 @@ func main() {
 	r.Use(middleware.RateLimitMiddleware(rlStore)) // Check RPM
 
 	// Admin Routes (Protected)
-	adminHandler := admin.NewAdminHandler(tenantStore, os.Getenv("ADMIN_API_KEY"))
+	adminHandler := admin.NewAdminHandler(tenantStore, os.Getenv("ADMIN_API_KEY"), adminOpts...)
 	adminGroup := r.Group("/admin")
 	adminGroup.Use(adminHandler.AuthMiddleware())
 	adminGroup.POST("/tenants", adminHandler.CreateTenant)
+	adminGroup.GET("/upstreams/health", adminHandler.UpstreamHealth)
 
 	// Routes
 	r.POST("/v1/chat/completions", proxyHandler.CreateCompletion)
+	r.POST("/v1/completions", proxyHandler.CreateTextCompletion)
+	r.POST("/v1/responses", proxyHandler.CreateResponse)
+	r.POST("/v1/embeddings", proxyHandler.CreateEmbedding)
+	r.GET("/v1/models", proxyHandler.ListModels)
+	r.GET("/v1/models/*id", proxyHandler.RetrieveModel)
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
@@ -118,6 +149,9 @@ func main() {
 		slog.Error("Server forced to shutdown", "error", err)
 	}
 
+	// Stop probing upstreams
+	stopHealth()
+
 	// Wait for async tasks (Usage Logs)
 	slog.Info("Waiting for async tasks to complete...")
 	if err := proxyHandler.Shutdown(ctx); err != nil {
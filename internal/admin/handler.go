@@ -5,19 +5,35 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/health"
 	"github.com/user/llm-gateway/internal/store"
 )
 
 type AdminHandler struct {
 	tenantStore store.TenantStore
 	apiKey      string // Admin API Key for protection
+	health      *health.Checker
 }
 
-func NewAdminHandler(ts store.TenantStore, apiKey string) *AdminHandler {
-	return &AdminHandler{
+// Option configures optional AdminHandler dependencies.
+type Option func(*AdminHandler)
+
+// WithHealthChecker exposes the upstream health checker's state.
+func WithHealthChecker(hc *health.Checker) Option {
+	return func(h *AdminHandler) {
+		h.health = hc
+	}
+}
+
+func NewAdminHandler(ts store.TenantStore, apiKey string, opts ...Option) *AdminHandler {
+	h := &AdminHandler{
 		tenantStore: ts,
 		apiKey:      apiKey,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Protected Middleware
@@ -39,6 +55,15 @@ type CreateTenantRequest struct {
 	RPMLimit      int      `json:"rpm_limit"`
 	TPMLimit      int      `json:"tpm_limit"`
 	AllowedModels []string `json:"allowed_models"`
+	// RetryPolicy caps how the tenant's requests are retried
+	RetryPolicy *store.RetryPolicy `json:"retry_policy"`
+	// Hedging enables hedged requests for the tenant
+	Hedging *store.HedgingConfig `json:"hedging"`
+	// ModelLimits overrides rpm_limit and tpm_limit per model ("*" for
+	// every model)
+	ModelLimits map[string]store.ModelLimit `json:"model_limits"`
+	// MaxConcurrent caps the tenant's in-flight requests (0 for no cap)
+	MaxConcurrent int `json:"max_concurrent"`
 }
 
 func (h *AdminHandler) CreateTenant(c *gin.Context) {
@@ -58,6 +83,24 @@ func (h *AdminHandler) CreateTenant(c *gin.Context) {
 	if len(req.AllowedModels) == 0 {
 		req.AllowedModels = []string{"*"}
 	}
+	if p := req.RetryPolicy; p != nil && (p.MaxAttempts < 0 || p.BaseBackoffMs < 0 || p.MaxBackoffMs < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retry_policy values must not be negative"})
+		return
+	}
+	if hc := req.Hedging; hc != nil && (hc.Percentile < 0 || hc.Percentile >= 1 || hc.MinDelayMs < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hedging percentile must be between 0 and 1 and min_delay_ms must not be negative"})
+		return
+	}
+	if req.MaxConcurrent < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_concurrent must not be negative"})
+		return
+	}
+	for model, l := range req.ModelLimits {
+		if l.RPMLimit < 0 || l.TPMLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model_limits for " + model + " must not be negative"})
+			return
+		}
+	}
 
 	tenant := &store.Tenant{
 		TenantID:      req.TenantID,
@@ -67,6 +110,10 @@ func (h *AdminHandler) CreateTenant(c *gin.Context) {
 		TPMLimit:      req.TPMLimit,
 		AllowedModels: req.AllowedModels,
 		IsActive:      true,
+		RetryPolicy:   req.RetryPolicy,
+		Hedging:       req.Hedging,
+		ModelLimits:   req.ModelLimits,
+		MaxConcurrent: req.MaxConcurrent,
 	}
 
 	if err := h.tenantStore.CreateTenant(context.Background(), tenant); err != nil {
@@ -76,3 +123,12 @@ func (h *AdminHandler) CreateTenant(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, tenant)
 }
+
+// UpstreamHealth lists the health check state of every model upstream.
+func (h *AdminHandler) UpstreamHealth(c *gin.Context) {
+	if h.health == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Health checking is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"upstreams": h.health.Statuses()})
+}
@@ -2,12 +2,17 @@ package admin
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/health"
 	"github.com/user/llm-gateway/internal/store"
 )
 
@@ -41,6 +46,42 @@ func TestCreateTenant(t *testing.T) {
 			body:       `{"tenant_id": "new-tenant", "name": "New Tenant", "api_key": "new-key"}`,
 			wantStatus: http.StatusCreated,
 		},
+		{
+			name:       "Negative Retry Policy",
+			apiKey:     "secret-admin-key",
+			body:       `{"tenant_id": "bad-retries", "name": "Bad Retries", "api_key": "bad-key", "retry_policy": {"max_attempts": -1}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid Hedging Percentile",
+			apiKey:     "secret-admin-key",
+			body:       `{"tenant_id": "bad-hedging", "name": "Bad Hedging", "api_key": "bad-hedging-key", "hedging": {"percentile": 95}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "With Retry Policy",
+			apiKey:     "secret-admin-key",
+			body:       `{"tenant_id": "retry-tenant", "name": "Retry Tenant", "api_key": "retry-key", "retry_policy": {"max_attempts": 2, "retryable_statuses": [503], "retry_on_timeout": false}}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Negative Model Limit",
+			apiKey:     "secret-admin-key",
+			body:       `{"tenant_id": "bad-limits", "name": "Bad Limits", "api_key": "bad-limits-key", "model_limits": {"gpt-4o": {"rpm_limit": -1}}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Negative Max Concurrent",
+			apiKey:     "secret-admin-key",
+			body:       `{"tenant_id": "bad-concurrency", "name": "Bad Concurrency", "api_key": "bad-concurrency-key", "max_concurrent": -1}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "With Model Limits",
+			apiKey:     "secret-admin-key",
+			body:       `{"tenant_id": "limits-tenant", "name": "Limits Tenant", "api_key": "limits-key", "model_limits": {"gpt-4o": {"rpm_limit": 50, "tpm_limit": 200000}}, "max_concurrent": 5}`,
+			wantStatus: http.StatusCreated,
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,5 +107,61 @@ func TestCreateTenant(t *testing.T) {
 	if assert.NotNil(t, tenant) {
 		assert.Equal(t, "new-tenant", tenant.TenantID)
 		assert.Equal(t, 100, tenant.RPMLimit) // Default
+		assert.Nil(t, tenant.RetryPolicy)
+	}
+
+	tenant, _ = mockStore.GetTenant(nil, "retry-key")
+	if assert.NotNil(t, tenant) && assert.NotNil(t, tenant.RetryPolicy) {
+		assert.Equal(t, 2, tenant.RetryPolicy.MaxAttempts)
+		assert.Equal(t, []int{503}, tenant.RetryPolicy.RetryableStatuses)
+		if assert.NotNil(t, tenant.RetryPolicy.RetryOnTimeout) {
+			assert.False(t, *tenant.RetryPolicy.RetryOnTimeout)
+		}
+	}
+	tenant, _ = mockStore.GetTenant(nil, "limits-key")
+	if assert.NotNil(t, tenant) {
+		assert.Equal(t, map[string]store.ModelLimit{"gpt-4o": {RPMLimit: 50, TPMLimit: 200000}}, tenant.ModelLimits)
+		assert.Equal(t, 5, tenant.MaxConcurrent)
+	}
+	tenant, _ = mockStore.GetTenant(nil, "bad-key")
+	assert.Nil(t, tenant)
+}
+
+func TestUpstreamHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	models := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{upstream.URL}, HealthCheck: &store.HealthCheckConfig{Path: "/health", ExpectedStatus: http.StatusOK}},
+		},
+	}
+	checker := health.NewChecker(models, time.Minute)
+	checker.CheckAll(context.Background())
+
+	// Disabled checker
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	NewAdminHandler(store.NewMockTenantStore(), "key").UpstreamHealth(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	NewAdminHandler(store.NewMockTenantStore(), "key", WithHealthChecker(checker)).UpstreamHealth(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Upstreams []health.EndpointStatus `json:"upstreams"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if assert.Len(t, body.Upstreams, 1) {
+		assert.Equal(t, "gpt-4", body.Upstreams[0].Model)
+		assert.Equal(t, upstream.URL, body.Upstreams[0].URL)
+		assert.True(t, body.Upstreams[0].Healthy)
+		assert.Equal(t, http.StatusOK, body.Upstreams[0].LastStatus)
 	}
 }
@@ -0,0 +1,286 @@
+// Package balancer orders a model's upstream endpoints for each request.
+// Endpoints are grouped into priority tiers, lowest first, so backup tiers
+// only take traffic when the preferred ones fail; a strategy orders the
+// endpoints within each tier.
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Strategies accepted in store.Model.LoadBalancing.
+const (
+	// Failover tries endpoints in configuration order.
+	Failover = "failover"
+	// WeightedRoundRobin spreads requests in proportion to endpoint weights.
+	WeightedRoundRobin = "weighted_round_robin"
+	// LeastOutstanding prefers the endpoint with the fewest in-flight
+	// requests per unit of weight.
+	LeastOutstanding = "least_outstanding"
+	// Latency prefers the endpoint with the lowest EWMA time to first byte
+	// of streamed responses, penalized by its in-flight requests.
+	Latency = "latency"
+)
+
+// ewmaAlpha is the weight of a new latency sample.
+const ewmaAlpha = 0.2
+
+const (
+	// latencyWindow is how many recent samples LatencyPercentile covers.
+	latencyWindow = 200
+	// minLatencySamples is how many samples LatencyPercentile needs before
+	// it reports anything.
+	minLatencySamples = 20
+)
+
+// Endpoint is an upstream base URL with its balancing parameters.
+type Endpoint struct {
+	URL string
+	// Weight is the endpoint's share of traffic within its tier (at least 1).
+	Weight int
+	// Priority is the endpoint's tier; lower tiers are preferred.
+	Priority int
+}
+
+// strategy ranks the endpoints of one tier, best first. It runs with the
+// balancer's lock held.
+type strategy interface {
+	rank(b *Balancer, tier []int)
+}
+
+// Balancer orders endpoints and tracks their in-flight requests and latency.
+// It is safe for concurrent use.
+type Balancer struct {
+	endpoints []Endpoint
+	tiers     [][]int // endpoint indexes grouped by priority, lowest first
+	strategy  strategy
+
+	mu          sync.Mutex
+	outstanding []int
+	latency     []float64 // EWMA of streamed first bytes in seconds, 0 until the first sample
+	current     []int     // smooth weighted round-robin state
+	next        int       // rotates ties so idle endpoints share traffic
+	// Recent latency of any endpoint, kept apart because non-streamed
+	// responses arrive only once the whole generation is done
+	streamed    window
+	nonStreamed window
+}
+
+// window holds the most recent latency samples.
+type window struct {
+	samples []time.Duration // a ring
+	n       int             // samples observed in total
+}
+
+func (w *window) add(d time.Duration) {
+	if len(w.samples) < latencyWindow {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.n%latencyWindow] = d
+	}
+	w.n++
+}
+
+// New returns a balancer over endpoints using the named strategy. An empty
+// name selects Failover.
+func New(name string, endpoints []Endpoint) (*Balancer, error) {
+	var s strategy
+	switch name {
+	case "", Failover:
+		s = failover{}
+	case WeightedRoundRobin:
+		s = weightedRoundRobin{}
+	case LeastOutstanding:
+		s = leastOutstanding{}
+	case Latency:
+		s = lowestLatency{}
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", name)
+	}
+
+	b := &Balancer{
+		endpoints:   make([]Endpoint, len(endpoints)),
+		strategy:    s,
+		outstanding: make([]int, len(endpoints)),
+		latency:     make([]float64, len(endpoints)),
+		current:     make([]int, len(endpoints)),
+	}
+	copy(b.endpoints, endpoints)
+
+	byPriority := map[int][]int{}
+	var priorities []int
+	for i := range b.endpoints {
+		if b.endpoints[i].Weight < 1 {
+			b.endpoints[i].Weight = 1
+		}
+		p := b.endpoints[i].Priority
+		if _, ok := byPriority[p]; !ok {
+			priorities = append(priorities, p)
+		}
+		byPriority[p] = append(byPriority[p], i)
+	}
+	sort.Ints(priorities)
+	for _, p := range priorities {
+		b.tiers = append(b.tiers, byPriority[p])
+	}
+	return b, nil
+}
+
+// Order returns the endpoint URLs in the order a request should try them.
+func (b *Balancer) Order() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	urls := make([]string, 0, len(b.endpoints))
+	for _, tier := range b.tiers {
+		ranked := make([]int, len(tier))
+		copy(ranked, tier)
+		b.strategy.rank(b, ranked)
+		for _, i := range ranked {
+			urls = append(urls, b.endpoints[i].URL)
+		}
+	}
+	b.next++
+	return urls
+}
+
+// Begin marks a request to url as in flight until the returned function is
+// called.
+func (b *Balancer) Begin(url string) (done func()) {
+	i := b.index(url)
+	if i < 0 {
+		return func() {}
+	}
+
+	b.mu.Lock()
+	b.outstanding[i]++
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.outstanding[i]--
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Observe records the time until response headers arrived from url, the
+// first byte of a streamed response or the whole of a non-streamed one. Only
+// streamed first bytes move the endpoint's EWMA, whose first sample seeds it.
+func (b *Balancer) Observe(url string, ttfb time.Duration, stream bool) {
+	i := b.index(url)
+	if i < 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !stream {
+		b.nonStreamed.add(ttfb)
+		return
+	}
+	b.streamed.add(ttfb)
+
+	if b.latency[i] == 0 {
+		b.latency[i] = ttfb.Seconds()
+		return
+	}
+	b.latency[i] = ewmaAlpha*ttfb.Seconds() + (1-ewmaAlpha)*b.latency[i]
+}
+
+// LatencyPercentile returns the p-th percentile (0-1) of the recent times
+// to response headers across all endpoints, of streamed or non-streamed
+// requests. It reports false until enough responses were observed.
+func (b *Balancer) LatencyPercentile(p float64, stream bool) (time.Duration, bool) {
+	w := &b.nonStreamed
+	if stream {
+		w = &b.streamed
+	}
+	b.mu.Lock()
+	if len(w.samples) < minLatencySamples {
+		b.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	b.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	rank = min(max(rank, 0), len(sorted)-1)
+	return sorted[rank], true
+}
+
+func (b *Balancer) index(url string) int {
+	for i, ep := range b.endpoints {
+		if ep.URL == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// rotate moves the tier's first b.next%len entries to the end, so endpoints
+// that rank equal take turns.
+func (b *Balancer) rotate(tier []int) {
+	if len(tier) < 2 {
+		return
+	}
+	n := b.next % len(tier)
+	rotated := append(append([]int{}, tier[n:]...), tier[:n]...)
+	copy(tier, rotated)
+}
+
+type failover struct{}
+
+func (failover) rank(b *Balancer, tier []int) {}
+
+// weightedRoundRobin is nginx's smooth weighted round-robin: the endpoint
+// with the highest running credit goes first and pays the tier's total
+// weight, which interleaves endpoints in proportion to their weights.
+type weightedRoundRobin struct{}
+
+func (weightedRoundRobin) rank(b *Balancer, tier []int) {
+	total := 0
+	for _, i := range tier {
+		b.current[i] += b.endpoints[i].Weight
+		total += b.endpoints[i].Weight
+	}
+	sort.SliceStable(tier, func(x, y int) bool {
+		return b.current[tier[x]] > b.current[tier[y]]
+	})
+	b.current[tier[0]] -= total
+}
+
+type leastOutstanding struct{}
+
+func (leastOutstanding) rank(b *Balancer, tier []int) {
+	b.rotate(tier)
+	load := func(i int) float64 {
+		return float64(b.outstanding[i]) / float64(b.endpoints[i].Weight)
+	}
+	sort.SliceStable(tier, func(x, y int) bool {
+		return load(tier[x]) < load(tier[y])
+	})
+}
+
+// lowestLatency ranks by EWMA latency times in-flight requests plus one
+// ("peak EWMA"), so a fast endpoint stops attracting traffic once it queues.
+// Endpoints without samples go first to seed their EWMA.
+type lowestLatency struct{}
+
+func (lowestLatency) rank(b *Balancer, tier []int) {
+	b.rotate(tier)
+	cost := func(i int) float64 {
+		return b.latency[i] * float64(b.outstanding[i]+1)
+	}
+	sort.SliceStable(tier, func(x, y int) bool {
+		return cost(tier[x]) < cost(tier[y])
+	})
+}
@@ -0,0 +1,149 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func firstPicks(t *testing.T, b *Balancer, n int) map[string]int {
+	t.Helper()
+	picks := map[string]int{}
+	for i := 0; i < n; i++ {
+		picks[b.Order()[0]]++
+	}
+	return picks
+}
+
+func TestFailover_PriorityTiers(t *testing.T) {
+	b, err := New("", []Endpoint{
+		{URL: "backup", Priority: 1},
+		{URL: "primary-a"},
+		{URL: "primary-b"},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, []string{"primary-a", "primary-b", "backup"}, b.Order())
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	b, err := New(WeightedRoundRobin, []Endpoint{
+		{URL: "a", Weight: 5},
+		{URL: "b"},
+		{URL: "c"},
+		{URL: "backup", Weight: 100, Priority: 1},
+	})
+	require.NoError(t, err)
+
+	// Smooth WRR interleaves instead of sending five in a row to a
+	var sequence []string
+	for i := 0; i < 7; i++ {
+		order := b.Order()
+		sequence = append(sequence, order[0])
+		assert.Equal(t, "backup", order[3], "Lower tiers always come last")
+	}
+	assert.Equal(t, []string{"a", "a", "b", "a", "c", "a", "a"}, sequence)
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	b, err := New(LeastOutstanding, []Endpoint{{URL: "a"}, {URL: "b", Weight: 2}})
+	require.NoError(t, err)
+
+	// Idle endpoints take turns
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, firstPicks(t, b, 4))
+
+	doneA := b.Begin("a")
+	assert.Equal(t, "b", b.Order()[0])
+
+	// b has twice the weight, so it takes two requests to look as busy as a
+	doneB1, doneB2 := b.Begin("b"), b.Begin("b")
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, firstPicks(t, b, 2))
+	doneB3 := b.Begin("b")
+	assert.Equal(t, "a", b.Order()[0])
+
+	doneA()
+	doneA() // Idempotent
+	doneB1()
+	doneB2()
+	doneB3()
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, firstPicks(t, b, 2))
+}
+
+func TestLatency(t *testing.T) {
+	b, err := New(Latency, []Endpoint{{URL: "slow"}, {URL: "fast"}, {URL: "new"}})
+	require.NoError(t, err)
+
+	b.Observe("slow", 400*time.Millisecond, true)
+	b.Observe("fast", 50*time.Millisecond, true)
+	assert.Equal(t, []string{"new", "fast", "slow"}, b.Order(), "Unmeasured endpoints go first to seed their EWMA")
+
+	b.Observe("new", 200*time.Millisecond, true)
+	assert.Equal(t, []string{"fast", "new", "slow"}, b.Order())
+
+	// Samples move the EWMA gradually
+	b.Observe("fast", 1050*time.Millisecond, true)
+	assert.InDelta(t, 0.25, b.latency[1], 1e-9)
+	assert.Equal(t, []string{"new", "fast", "slow"}, b.Order())
+
+	// Non-streamed response times cover the whole generation
+	b.Observe("new", 30*time.Second, false)
+	assert.Equal(t, []string{"new", "fast", "slow"}, b.Order())
+
+	// In-flight requests penalize an endpoint
+	var done []func()
+	for i := 0; i < 2; i++ {
+		done = append(done, b.Begin("new"))
+	}
+	assert.Equal(t, "fast", b.Order()[0])
+	for _, d := range done {
+		d()
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	b, err := New(Failover, []Endpoint{{URL: "a"}, {URL: "b"}})
+	require.NoError(t, err)
+
+	for i := 1; i < minLatencySamples; i++ {
+		b.Observe("a", time.Duration(i)*time.Millisecond, true)
+	}
+	_, ok := b.LatencyPercentile(0.95, true)
+	assert.False(t, ok, "Too few samples")
+
+	for i := minLatencySamples; i <= 100; i++ {
+		b.Observe("b", time.Duration(i)*time.Millisecond, true)
+	}
+	p95, ok := b.LatencyPercentile(0.95, true)
+	assert.True(t, ok)
+	assert.Equal(t, 95*time.Millisecond, p95)
+
+	p50, _ := b.LatencyPercentile(0.5, true)
+	assert.Equal(t, 50*time.Millisecond, p50)
+
+	// Old samples leave the window
+	for i := 0; i < latencyWindow; i++ {
+		b.Observe("a", time.Second, true)
+	}
+	p50, _ = b.LatencyPercentile(0.5, true)
+	assert.Equal(t, time.Second, p50)
+
+	// Streamed and non-streamed requests are measured apart
+	_, ok = b.LatencyPercentile(0.5, false)
+	assert.False(t, ok)
+	for i := 0; i < minLatencySamples; i++ {
+		b.Observe("a", time.Minute, false)
+	}
+	p50, _ = b.LatencyPercentile(0.5, false)
+	assert.Equal(t, time.Minute, p50)
+	p50, _ = b.LatencyPercentile(0.5, true)
+	assert.Equal(t, time.Second, p50)
+}
+
+func TestNew_UnknownStrategy(t *testing.T) {
+	_, err := New("random", []Endpoint{{URL: "a"}})
+	assert.Error(t, err)
+}
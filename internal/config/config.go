@@ -12,6 +12,9 @@ type Config struct {
 	RedisAddr         string
 	RedisPassword     string
 	LLMTimeout        time.Duration
+	TokenizerDir      string
+	// HealthCheckInterval is how often upstreams are probed; 0 disables it.
+	HealthCheckInterval time.Duration
 }
 
 func LoadConfig() *Config {
@@ -21,13 +24,20 @@ func LoadConfig() *Config {
 		timeout = 60 * time.Second
 	}
 
+	healthInterval, err := time.ParseDuration(getEnv("HEALTH_CHECK_INTERVAL", "30s"))
+	if err != nil {
+		healthInterval = 30 * time.Second
+	}
+
 	return &Config{
-		ServerPort:        getEnv("SERVER_PORT", "8080"),
-		AWSRegion:         getEnv("AWS_REGION", "us-east-1"),
-		DynamoDBTableName: getEnv("DYNAMODB_TABLE_NAME", "LLMGateway_Tenants"),
-		RedisAddr:         getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:     getEnv("REDIS_PASSWORD", ""),
-		LLMTimeout:        timeout,
+		ServerPort:          getEnv("SERVER_PORT", "8080"),
+		AWSRegion:           getEnv("AWS_REGION", "us-east-1"),
+		DynamoDBTableName:   getEnv("DYNAMODB_TABLE_NAME", "LLMGateway_Tenants"),
+		RedisAddr:           getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:       getEnv("REDIS_PASSWORD", ""),
+		LLMTimeout:          timeout,
+		TokenizerDir:        getEnv("TOKENIZER_DIR", ""),
+		HealthCheckInterval: healthInterval,
 	}
 }
 
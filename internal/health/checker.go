@@ -0,0 +1,266 @@
+// Package health actively probes the upstreams of models that opt in, so
+// unhealthy endpoints are taken out of rotation before tenant requests fail
+// on them.
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/llm-gateway/internal/middleware"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// Probe defaults, used for store.HealthCheckConfig fields left at zero.
+const (
+	defaultProbeTimeout       = 5 * time.Second
+	defaultUnhealthyThreshold = 3
+	defaultHealthyThreshold   = 2
+)
+
+// EndpointStatus is the health of one model base URL.
+type EndpointStatus struct {
+	Model                string    `json:"model"`
+	URL                  string    `json:"url"`
+	Healthy              bool      `json:"healthy"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	LastStatus           int       `json:"last_status,omitempty"`
+	LastError            string    `json:"last_error,omitempty"`
+	LastLatencyMs        int64     `json:"last_latency_ms"`
+	LastChecked          time.Time `json:"last_checked"`
+}
+
+type endpointKey struct {
+	model   string
+	baseURL string
+}
+
+// Checker periodically probes the base URLs of every model with a health
+// check configured (see store.HealthCheckConfig). Endpoints change state
+// only after consecutive failures or successes (hysteresis), so a single
+// slow probe does not flap them.
+type Checker struct {
+	modelStore store.ModelStore
+	client     *http.Client
+	interval   time.Duration
+
+	mu       sync.RWMutex
+	statuses map[endpointKey]*EndpointStatus
+}
+
+func NewChecker(modelStore store.ModelStore, interval time.Duration) *Checker {
+	return &Checker{
+		modelStore: modelStore,
+		client:     &http.Client{},
+		interval:   interval,
+		statuses:   make(map[endpointKey]*EndpointStatus),
+	}
+}
+
+// Start probes every interval until ctx is canceled.
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			c.CheckAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Healthy reports whether the endpoint may receive traffic. Endpoints that
+// have not been probed yet are healthy.
+func (c *Checker) Healthy(modelID, baseURL string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st, ok := c.statuses[endpointKey{model: modelID, baseURL: baseURL}]
+	return !ok || st.Healthy
+}
+
+// Statuses returns the health of every probed endpoint, by model and URL.
+func (c *Checker) Statuses() []EndpointStatus {
+	c.mu.RLock()
+	out := make([]EndpointStatus, 0, len(c.statuses))
+	for _, st := range c.statuses {
+		out = append(out, *st)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].URL < out[j].URL
+	})
+	return out
+}
+
+// CheckAll probes every base URL of every model that opts in once,
+// concurrently, and forgets endpoints that are no longer probed.
+func (c *Checker) CheckAll(ctx context.Context) {
+	models, err := c.modelStore.ListModels(ctx)
+	if err != nil {
+		slog.Error("Health check failed to list models", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	active := make(map[endpointKey]bool)
+	for _, m := range models {
+		cfg := m.HealthCheck
+		if cfg == nil || cfg.Disabled {
+			continue
+		}
+		if cfg.Path == "" || cfg.ExpectedStatus == 0 {
+			slog.Warn("Health check needs a path and an expected status, not probing", "model", m.ModelID)
+			continue
+		}
+		for _, baseURL := range m.BaseURLs {
+			key := endpointKey{model: m.ModelID, baseURL: baseURL}
+			active[key] = true
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.check(ctx, key, *cfg)
+			}()
+		}
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	for key := range c.statuses {
+		if !active[key] {
+			delete(c.statuses, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *Checker) check(ctx context.Context, key endpointKey, cfg store.HealthCheckConfig) {
+	start := time.Now()
+	status, err := c.probe(ctx, key.baseURL, cfg)
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		return // Shutting down, not an upstream failure
+	}
+
+	ok := err == nil && status == cfg.ExpectedStatus
+
+	unhealthyAfter := cfg.UnhealthyThreshold
+	if unhealthyAfter <= 0 {
+		unhealthyAfter = defaultUnhealthyThreshold
+	}
+	healthyAfter := cfg.HealthyThreshold
+	if healthyAfter <= 0 {
+		healthyAfter = defaultHealthyThreshold
+	}
+
+	c.mu.Lock()
+	st, found := c.statuses[key]
+	if !found {
+		st = &EndpointStatus{Model: key.model, URL: key.baseURL, Healthy: true}
+		c.statuses[key] = st
+	}
+	st.LastChecked = start
+	st.LastLatencyMs = latency.Milliseconds()
+	st.LastStatus = status
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	} else if !ok {
+		st.LastError = fmt.Sprintf("unexpected status %d", status)
+	}
+
+	wasHealthy := st.Healthy
+	if ok {
+		st.ConsecutiveSuccesses++
+		st.ConsecutiveFailures = 0
+		if !st.Healthy && st.ConsecutiveSuccesses >= healthyAfter {
+			st.Healthy = true
+		}
+	} else {
+		st.ConsecutiveFailures++
+		st.ConsecutiveSuccesses = 0
+		if st.Healthy && st.ConsecutiveFailures >= unhealthyAfter {
+			st.Healthy = false
+		}
+	}
+	healthy := st.Healthy
+	lastError := st.LastError
+	c.mu.Unlock()
+
+	if healthy != wasHealthy {
+		if healthy {
+			slog.Info("Upstream is healthy again", "model", key.model, "url", key.baseURL)
+		} else {
+			slog.Warn("Upstream marked unhealthy", "model", key.model, "url", key.baseURL, "error", lastError)
+		}
+	}
+	middleware.RecordUpstreamHealth(key.model, key.baseURL, ok, healthy)
+}
+
+// probe sends one health check request and returns its status code.
+func (c *Checker) probe(ctx context.Context, baseURL string, cfg store.HealthCheckConfig) (int, error) {
+	target, err := probeURL(baseURL, cfg.Path)
+	if err != nil {
+		return 0, err
+	}
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := defaultProbeTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Let the connection be reused
+	return resp.StatusCode, nil
+}
+
+// probeURL resolves path against baseURL. A path starting with "/" replaces
+// the base URL's path; any other path is appended to it, even when the base
+// URL does not end in "/".
+func probeURL(baseURL, path string) (string, error) {
+	if path == "" {
+		return baseURL, nil
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %w", err)
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid health check path: %w", err)
+	}
+	if ref.Scheme == "" && ref.Host == "" && !strings.HasPrefix(ref.Path, "/") {
+		ref.Path = base.JoinPath(ref.Path).Path
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestChecker_Hysteresis(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var lastPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.Method + " " + r.URL.Path
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer upstream.Close()
+
+	baseURL := upstream.URL + "/v1/chat/completions"
+	models := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{baseURL}, HealthCheck: &store.HealthCheckConfig{
+				Path:               "/v1/models",
+				Method:             "head",
+				ExpectedStatus:     http.StatusOK,
+				UnhealthyThreshold: 2,
+				HealthyThreshold:   2,
+			}},
+		},
+	}
+	c := NewChecker(models, 0)
+	ctx := context.Background()
+
+	assert.True(t, c.Healthy("gpt-4", baseURL), "Unprobed endpoints are healthy")
+	c.CheckAll(ctx)
+	assert.Equal(t, "HEAD /v1/models", lastPath)
+	assert.True(t, c.Healthy("gpt-4", baseURL))
+
+	// One failure is tolerated, the second marks the endpoint unhealthy
+	status.Store(http.StatusBadGateway)
+	c.CheckAll(ctx)
+	assert.True(t, c.Healthy("gpt-4", baseURL))
+	c.CheckAll(ctx)
+	assert.False(t, c.Healthy("gpt-4", baseURL))
+
+	statuses := c.Statuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, 2, statuses[0].ConsecutiveFailures)
+	assert.Equal(t, http.StatusBadGateway, statuses[0].LastStatus)
+	assert.Equal(t, "unexpected status 502", statuses[0].LastError)
+
+	// Recovery also needs consecutive successes
+	status.Store(http.StatusOK)
+	c.CheckAll(ctx)
+	assert.False(t, c.Healthy("gpt-4", baseURL))
+	c.CheckAll(ctx)
+	assert.True(t, c.Healthy("gpt-4", baseURL))
+}
+
+func TestChecker_OptIn(t *testing.T) {
+	var probes atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if r.URL.Path != "/health" {
+			// Like a provider's API root, which says nothing of its health
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+
+	models := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"probed":     {ModelID: "probed", BaseURLs: []string{upstream.URL}, HealthCheck: &store.HealthCheckConfig{Path: "/health", ExpectedStatus: http.StatusNoContent}},
+			"strict":     {ModelID: "strict", BaseURLs: []string{upstream.URL}, HealthCheck: &store.HealthCheckConfig{Path: "/v1/models", ExpectedStatus: http.StatusOK, UnhealthyThreshold: 1}},
+			"default":    {ModelID: "default", BaseURLs: []string{upstream.URL}},
+			"incomplete": {ModelID: "incomplete", BaseURLs: []string{upstream.URL}, HealthCheck: &store.HealthCheckConfig{UnhealthyThreshold: 1}},
+			"off":        {ModelID: "off", BaseURLs: []string{upstream.URL}, HealthCheck: &store.HealthCheckConfig{Disabled: true, Path: "/health", ExpectedStatus: http.StatusNoContent}},
+		},
+	}
+	c := NewChecker(models, 0)
+	c.CheckAll(context.Background())
+
+	assert.Equal(t, int32(2), probes.Load(), "Only models with a path and expected status are probed")
+	assert.True(t, c.Healthy("probed", upstream.URL))
+	assert.False(t, c.Healthy("strict", upstream.URL), "Only the expected status is healthy")
+	assert.True(t, c.Healthy("default", upstream.URL))
+	assert.True(t, c.Healthy("incomplete", upstream.URL))
+	assert.Len(t, c.Statuses(), 2)
+
+	// Endpoints removed from the model table are forgotten
+	delete(models.Models, "strict")
+	c.CheckAll(context.Background())
+	assert.Len(t, c.Statuses(), 1)
+}
+
+func TestProbeURL(t *testing.T) {
+	tests := []struct {
+		baseURL, path, want string
+	}{
+		{"https://api.openai.com/v1/chat/completions", "", "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/v1/chat/completions", "/v1/models", "https://api.openai.com/v1/models"},
+		{"http://vllm:8000/v1/", "health", "http://vllm:8000/v1/health"},
+		// Relative paths extend a base URL's path prefix
+		{"https://api.openai.com/v1", "models", "https://api.openai.com/v1/models"},
+		{"https://gateway.example.com/openai/v1", "models?limit=1", "https://gateway.example.com/openai/v1/models?limit=1"},
+		{"https://gateway.example.com/openai/v1", "/healthz", "https://gateway.example.com/healthz"},
+	}
+	for _, tt := range tests {
+		got, err := probeURL(tt.baseURL, tt.path)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+}
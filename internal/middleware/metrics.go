@@ -44,6 +44,62 @@ var (
 		},
 		[]string{"tenant_id", "model"},
 	)
+
+	llmCircuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_circuit_breaker_state",
+			Help: "Circuit breaker state per model upstream (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"model", "upstream"},
+	)
+
+	llmUpstreamHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "llm_upstream_healthy",
+			Help: "Whether a model upstream passes its active health checks (1 healthy, 0 unhealthy)",
+		},
+		[]string{"model", "upstream"},
+	)
+
+	llmHealthProbes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_health_probes_total",
+			Help: "Total number of upstream health probes",
+		},
+		[]string{"model", "upstream", "result"},
+	)
+
+	llmHedgedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_hedged_requests_total",
+			Help: "Total number of hedged upstream requests by the call that won",
+		},
+		[]string{"model", "winner"},
+	)
+
+	llmStreamInterruptions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_stream_interruptions_total",
+			Help: "Total number of streams that ended before their terminal event",
+		},
+		[]string{"model", "reason"},
+	)
+
+	llmUpstreamTimeouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_upstream_timeouts_total",
+			Help: "Total number of upstream attempts that timed out, by phase",
+		},
+		[]string{"model", "phase"},
+	)
+
+	llmRateLimited = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_rate_limited_total",
+			Help: "Total number of requests rejected by tenant rate limits",
+		},
+		[]string{"tenant_id", "model", "limit"},
+	)
 )
 
 func MetricsMiddleware() gin.HandlerFunc {
@@ -85,3 +141,49 @@ func RecordTokenUsage(tenantID, model string, inputTokens, outputTokens int) {
 func RecordTTFT(tenantID, model string, durationSeconds float64) {
 	llmTTFT.WithLabelValues(tenantID, model).Observe(durationSeconds)
 }
+
+// RecordCircuitBreakerState records the state of an upstream's breaker
+// (0 closed, 1 half-open, 2 open)
+func RecordCircuitBreakerState(model, upstream string, state int) {
+	llmCircuitBreakerState.WithLabelValues(model, upstream).Set(float64(state))
+}
+
+// RecordUpstreamHealth records an upstream's health check result: the probe
+// outcome and the resulting health state
+func RecordUpstreamHealth(model, upstream string, probeOK, healthy bool) {
+	result := "failure"
+	if probeOK {
+		result = "success"
+	}
+	llmHealthProbes.WithLabelValues(model, upstream, result).Inc()
+
+	state := 0.0
+	if healthy {
+		state = 1
+	}
+	llmUpstreamHealthy.WithLabelValues(model, upstream).Set(state)
+}
+
+// RecordHedge records a hedged request and which call won ("primary",
+// "hedge" or "none" when both failed)
+func RecordHedge(model, winner string) {
+	llmHedgedRequests.WithLabelValues(model, winner).Inc()
+}
+
+// RecordStreamInterruption records a stream that ended early and why
+// ("idle_timeout", "upstream_error", "truncated" or "client_closed")
+func RecordStreamInterruption(model, reason string) {
+	llmStreamInterruptions.WithLabelValues(model, reason).Inc()
+}
+
+// RecordUpstreamTimeout records an upstream attempt that timed out and in
+// which phase ("dial", "tls_handshake", "first_byte", "idle" or "total")
+func RecordUpstreamTimeout(model, phase string) {
+	llmUpstreamTimeouts.WithLabelValues(model, phase).Inc()
+}
+
+// RecordRateLimited records a request rejected by its tenant's limit for
+// model ("rpm" or "tpm")
+func RecordRateLimited(tenantID, model, limit string) {
+	llmRateLimited.WithLabelValues(tenantID, model, limit).Inc()
+}
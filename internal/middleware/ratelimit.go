@@ -1,8 +1,14 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/llm-gateway/internal/store"
@@ -18,43 +24,52 @@ func RateLimitMiddleware(rlStore store.RateLimitStore) gin.HandlerFunc {
 		}
 		tenant := tenantCtx.(*store.Tenant)
 
-		// Check RPM
-		currentRPM, err := rlStore.IncrementRPM(c.Request.Context(), tenant.TenantID)
+		// Tenants may have per-model limits, so find the model first
+		model := requestModel(c)
+		limits := tenant.RateLimitsFor(model)
+		logger := slog.With("tenant_id", tenant.TenantID, "model", model)
+
+		// Check TPM (Tokens Per Minute) first, so requests it rejects are
+		// not counted against the RPM limit.
+		// This only turns away tenants with no quota left before their
+		// body is read; the Handler reserves each request's estimated
+		// tokens once it has parsed the request.
+		tpm, err := rlStore.CheckTokens(c.Request.Context(), tenant.TenantID, limits.Model, limits.TPMLimit)
 		if err != nil {
-			slog.Error("Rate limit check failed", "error", err, "tenant_id", tenant.TenantID)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Rate limit check failed"})
+			logger.Error("TPM check failed", "error", err)
+			// checking TPM failure shouldn't block? failing closed for safety
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Rate limit check failed (TPM)"})
 			return
 		}
 
-		if currentRPM > int64(tenant.RPMLimit) {
-			slog.Warn("Rate limit exceeded (RPM)", "tenant_id", tenant.TenantID, "limit", tenant.RPMLimit, "current", currentRPM)
-			c.Header("Retry-After", "60")
+		SetRateLimitHeaders(c, "tokens", tpm)
+		if !tpm.Allowed {
+			logger.Warn("Rate limit exceeded (TPM)", "limit", limits.TPMLimit, "retry_after", tpm.RetryAfter)
+			rejected(c, tenant, model, "tpm")
+			SetRetryAfter(c, tpm)
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded (RPM)",
-				"limit": tenant.RPMLimit,
+				"error": "Rate limit exceeded (TPM)",
+				"limit": limits.TPMLimit,
 			})
 			return
 		}
 
-		// Check TPM (Tokens Per Minute)
-		// We check the *current* usage against the limit.
-		// Note: We are not adding the current request's tokens here because we haven't processed it yet.
-		// This is a "Check then Act" (with Act happening asynchronously in Handler).
-		// It's slightly loose but performant.
-		currentTPM, err := rlStore.GetTPM(c.Request.Context(), tenant.TenantID)
+		// Check RPM
+		rpm, err := rlStore.AllowRequest(c.Request.Context(), tenant.TenantID, limits.Model, limits.RPMLimit)
 		if err != nil {
-			slog.Error("TPM check failed", "error", err)
-			// checking TPM failure shouldn't block? failing closed for safety
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Rate limit check failed (TPM)"})
+			logger.Error("Rate limit check failed", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Rate limit check failed"})
 			return
 		}
 
-		if currentTPM > int64(tenant.TPMLimit) {
-			slog.Warn("Rate limit exceeded (TPM)", "tenant_id", tenant.TenantID, "limit", tenant.TPMLimit, "current", currentTPM)
-			c.Header("Retry-After", "60")
+		SetRateLimitHeaders(c, "requests", rpm)
+		if !rpm.Allowed {
+			logger.Warn("Rate limit exceeded (RPM)", "limit", limits.RPMLimit, "retry_after", rpm.RetryAfter)
+			rejected(c, tenant, model, "rpm")
+			SetRetryAfter(c, rpm)
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded (TPM)",
-				"limit": tenant.TPMLimit,
+				"error": "Rate limit exceeded (RPM)",
+				"limit": limits.RPMLimit,
 			})
 			return
 		}
@@ -62,3 +77,61 @@ func RateLimitMiddleware(rlStore store.RateLimitStore) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// rejected records a request turned away by a rate limit, labelling the
+// request's metrics with its model.
+func rejected(c *gin.Context, tenant *store.Tenant, model, limit string) {
+	if model == "" {
+		model = "unknown"
+	}
+	c.Set("model", model)
+	RecordRateLimited(tenant.TenantID, model, limit)
+}
+
+// MaxBodyBytes caps the size of request bodies, to prevent OOM.
+const MaxBodyBytes = 10 * 1024 * 1024
+
+// requestModel returns the model a request's JSON body names, or "" when
+// it names none. The body is left for the handler to read.
+func requestModel(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	buf, err := io.ReadAll(io.LimitReader(c.Request.Body, MaxBodyBytes+1))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), c.Request.Body), c.Request.Body}
+	// Oversized bodies are rejected by the handler
+	if err != nil || len(buf) > MaxBodyBytes {
+		return ""
+	}
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(buf, &req) != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// SetRateLimitHeaders reports the state of a tenant's limit in OpenAI's
+// x-ratelimit-* headers; kind is "requests" or "tokens". Unlimited tenants
+// get none.
+func SetRateLimitHeaders(c *gin.Context, kind string, r store.RateLimitResult) {
+	if r.Limit <= 0 {
+		return
+	}
+	c.Header("x-ratelimit-limit-"+kind, strconv.FormatInt(r.Limit, 10))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(r.Remaining, 10))
+	// Durations like OpenAI's ("1s", "6m0s", "20ms")
+	c.Header("x-ratelimit-reset-"+kind, r.Reset.Round(time.Millisecond).String())
+}
+
+// SetRetryAfter tells a denied client how many seconds to wait before its
+// request would be allowed.
+func SetRetryAfter(c *gin.Context, r store.RateLimitResult) {
+	seconds := max(int64(math.Ceil(r.RetryAfter.Seconds())), 1)
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+}
@@ -1,13 +1,18 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/user/llm-gateway/internal/store"
 )
 
@@ -32,7 +37,9 @@ func TestRateLimitMiddleware(t *testing.T) {
 			name: "RPM Limit Exceeded",
 			setupStore: func() *store.MockRateLimitStore {
 				m := store.NewMockRateLimitStore()
-				m.RPM["t1"] = 11 // > 10
+				for i := 0; i < 10; i++ {
+					m.AllowRequest(context.Background(), "t1", "", 10)
+				}
 				return m
 			},
 			tenant:         &store.Tenant{TenantID: "t1", RPMLimit: 10, TPMLimit: 100},
@@ -42,7 +49,7 @@ func TestRateLimitMiddleware(t *testing.T) {
 			name: "TPM Limit Exceeded",
 			setupStore: func() *store.MockRateLimitStore {
 				m := store.NewMockRateLimitStore()
-				m.TPM["t1"] = 101 // > 100
+				m.CommitTokens(context.Background(), "t1", "", 0, 101, 100) // > 100
 				return m
 			},
 			tenant:         &store.Tenant{TenantID: "t1", RPMLimit: 10, TPMLimit: 100},
@@ -76,3 +83,83 @@ func TestRateLimitMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func assertDuration(t *testing.T, want time.Duration, header string) {
+	t.Helper()
+	got, err := time.ParseDuration(header)
+	if assert.NoError(t, err) {
+		assert.InDelta(t, want, got, float64(100*time.Millisecond))
+	}
+}
+
+func TestRateLimitMiddleware_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rlStore := store.NewMockRateLimitStore()
+	tenant := &store.Tenant{TenantID: "t1", RPMLimit: 2, TPMLimit: 600}
+	rlStore.CommitTokens(context.Background(), "t1", "", 0, 100, 600)
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		c.Set("tenant", tenant)
+		RateLimitMiddleware(rlStore)(c)
+		return w
+	}
+
+	w := send()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "1", w.Header().Get("x-ratelimit-remaining-requests"))
+	assertDuration(t, 30*time.Second, w.Header().Get("x-ratelimit-reset-requests"))
+	assert.Equal(t, "600", w.Header().Get("x-ratelimit-limit-tokens"))
+	assert.Equal(t, "500", w.Header().Get("x-ratelimit-remaining-tokens"))
+	assertDuration(t, 10*time.Second, w.Header().Get("x-ratelimit-reset-tokens"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	send()
+	w = send()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("x-ratelimit-remaining-requests"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "One request frees up every 30s")
+}
+
+func TestRateLimitMiddleware_PerModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rlStore := store.NewMockRateLimitStore()
+	tenant := &store.Tenant{
+		TenantID:    "t1",
+		RPMLimit:    10,
+		TPMLimit:    1000,
+		ModelLimits: map[string]store.ModelLimit{"gpt-4o": {RPMLimit: 1}},
+	}
+
+	send := func(model string) *httptest.ResponseRecorder {
+		body := `{"model": "` + model + `", "messages": []}`
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		c.Set("tenant", tenant)
+		RateLimitMiddleware(rlStore)(c)
+
+		forwarded, err := io.ReadAll(c.Request.Body)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(forwarded), "The body is left for the handler")
+		return w
+	}
+
+	w := send("gpt-4o")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "1000", w.Header().Get("x-ratelimit-limit-tokens"), "Unset overrides keep the tenant's limit")
+
+	w = send("gpt-4o")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"limit":1`)
+
+	// Other models share the tenant's budget, which gpt-4o does not use
+	w = send("gpt-3.5-turbo")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "9", w.Header().Get("x-ratelimit-remaining-requests"))
+}
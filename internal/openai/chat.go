@@ -0,0 +1,249 @@
+// Package openai models the OpenAI API wire format shared by the proxy and
+// the provider adapters.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// ChatRequest is a /v1/chat/completions request body.
+type ChatRequest struct {
+	Model               string             `json:"model"`
+	Messages            []Message          `json:"messages"`
+	Stream              bool               `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions     `json:"stream_options,omitempty"`
+	MaxTokens           *int               `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int               `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64           `json:"temperature,omitempty"`
+	TopP                *float64           `json:"top_p,omitempty"`
+	N                   *int               `json:"n,omitempty"`
+	Stop                Stop               `json:"stop,omitempty"`
+	Seed                *int64             `json:"seed,omitempty"`
+	PresencePenalty     *float64           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float64           `json:"frequency_penalty,omitempty"`
+	LogitBias           map[string]float64 `json:"logit_bias,omitempty"`
+	Logprobs            *bool              `json:"logprobs,omitempty"`
+	TopLogprobs         *int               `json:"top_logprobs,omitempty"`
+	Tools               []Tool             `json:"tools,omitempty"`
+	ToolChoice          *ToolChoice        `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool              `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat      *ResponseFormat    `json:"response_format,omitempty"`
+	User                string             `json:"user,omitempty"`
+}
+
+// MaxOutputTokens returns the requested completion limit, preferring
+// max_completion_tokens over the deprecated max_tokens.
+func (r *ChatRequest) MaxOutputTokens() *int {
+	if r.MaxCompletionTokens != nil {
+		return r.MaxCompletionTokens
+	}
+	return r.MaxTokens
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type Message struct {
+	Role       string     `json:"role"`
+	Name       string     `json:"name,omitempty"`
+	Content    Content    `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Content is a message's content: either a plain string (Text) or an array
+// of typed parts (Parts), e.g. text mixed with image_url.
+type Content struct {
+	Text  string
+	Parts []ContentPart
+}
+
+// String returns the text of the content, joining text parts.
+func (c Content) String() string {
+	if c.Parts == nil {
+		return c.Text
+	}
+	var sb strings.Builder
+	for _, p := range c.Parts {
+		if p.Type == "text" {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*c = Content{}
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		c.Parts = nil
+		return json.Unmarshal(data, &c.Text)
+	case len(data) > 0 && data[0] == '[':
+		c.Text = ""
+		c.Parts = []ContentPart{}
+		return json.Unmarshal(data, &c.Parts)
+	default:
+		return typeError(data, reflect.TypeOf(c).Elem(), "messages.content")
+	}
+}
+
+func (c Content) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	return json.Marshal(c.Text)
+}
+
+type ContentPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+}
+
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+type Function struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// ToolChoice is either a mode ("none", "auto", "required") or a specific
+// function to call.
+type ToolChoice struct {
+	Mode     string
+	Function string
+}
+
+func (t *ToolChoice) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		*t = ToolChoice{}
+		return json.Unmarshal(data, &t.Mode)
+	}
+	if len(data) == 0 || data[0] != '{' {
+		return typeError(data, reflect.TypeOf(t).Elem(), "tool_choice")
+	}
+
+	var named struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+	*t = ToolChoice{Mode: named.Type, Function: named.Function.Name}
+	return nil
+}
+
+func (t ToolChoice) MarshalJSON() ([]byte, error) {
+	if t.Function == "" {
+		return json.Marshal(t.Mode)
+	}
+	return json.Marshal(map[string]any{
+		"type":     "function",
+		"function": map[string]string{"name": t.Function},
+	})
+}
+
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// Stop accepts "stop" as either a string or an array of strings.
+type Stop []string
+
+func (s *Stop) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = nil
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var one string
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		*s = Stop{one}
+		return nil
+	case len(data) > 0 && data[0] == '[':
+		var many []string
+		if err := json.Unmarshal(data, &many); err != nil {
+			return err
+		}
+		*s = many
+		return nil
+	default:
+		return typeError(data, reflect.TypeOf(s).Elem(), "stop")
+	}
+}
+
+// typeError reports a JSON value of the wrong kind for a union type. The
+// decoder does not add the field path to errors returned by an Unmarshaler,
+// so each union type names the request field it is used for.
+func typeError(data []byte, t reflect.Type, field string) error {
+	return &json.UnmarshalTypeError{Value: jsonKind(data), Type: t, Field: field}
+}
+
+func jsonKind(data []byte) string {
+	if len(data) == 0 {
+		return "empty"
+	}
+	switch data[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
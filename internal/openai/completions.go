@@ -0,0 +1,95 @@
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// CompletionRequest is a legacy /v1/completions request body.
+type CompletionRequest struct {
+	Model            string             `json:"model"`
+	Prompt           Prompt             `json:"prompt"`
+	Suffix           string             `json:"suffix,omitempty"`
+	Stream           bool               `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions     `json:"stream_options,omitempty"`
+	MaxTokens        *int               `json:"max_tokens,omitempty"`
+	Temperature      *float64           `json:"temperature,omitempty"`
+	TopP             *float64           `json:"top_p,omitempty"`
+	N                *int               `json:"n,omitempty"`
+	BestOf           *int               `json:"best_of,omitempty"`
+	Echo             bool               `json:"echo,omitempty"`
+	Stop             Stop               `json:"stop,omitempty"`
+	Seed             *int64             `json:"seed,omitempty"`
+	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
+	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
+	Logprobs         *int               `json:"logprobs,omitempty"`
+	User             string             `json:"user,omitempty"`
+}
+
+// Prompt is the text to complete, see TextInput.
+type Prompt struct {
+	TextInput
+}
+
+func (p *Prompt) UnmarshalJSON(data []byte) error {
+	return p.decode(data, reflect.TypeOf(p).Elem(), "prompt")
+}
+
+// DecodeCompletionRequest parses a legacy completions request body,
+// translating JSON errors into field-level API errors.
+func DecodeCompletionRequest(body []byte) (*CompletionRequest, *Error) {
+	var req CompletionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, decodeError(err)
+	}
+	return &req, nil
+}
+
+// Validate checks the request against the ranges the OpenAI API accepts and
+// returns the first violation.
+func (r *CompletionRequest) Validate() *Error {
+	if r.Model == "" {
+		return InvalidRequest("model", "missing_required_parameter", "Missing required parameter: 'model'.")
+	}
+	if r.Prompt.Len() == 0 {
+		return InvalidRequest("prompt", "missing_required_parameter", "Missing required parameter: 'prompt'.")
+	}
+	if r.StreamOptions != nil && !r.Stream {
+		return InvalidRequest("stream_options", "invalid_value", "The 'stream_options' parameter is only allowed when 'stream' is enabled.")
+	}
+	if err := checkIntMin("max_tokens", r.MaxTokens, 1); err != nil {
+		return err
+	}
+	if err := checkRange("temperature", r.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := checkRange("top_p", r.TopP, 0, 1); err != nil {
+		return err
+	}
+	if err := checkRange("presence_penalty", r.PresencePenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := checkRange("frequency_penalty", r.FrequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := checkIntRange("n", r.N, 1, 128); err != nil {
+		return err
+	}
+	if err := checkIntRange("best_of", r.BestOf, 1, 20); err != nil {
+		return err
+	}
+	if r.BestOf != nil && r.N != nil && *r.BestOf < *r.N {
+		return InvalidRequest("best_of", "invalid_value", "Invalid 'best_of': must be at least 'n' (%d), got %d.", *r.N, *r.BestOf)
+	}
+	if r.BestOf != nil && *r.BestOf > 1 && r.Stream {
+		return InvalidRequest("best_of", "invalid_value", "Invalid 'best_of': 'best_of' greater than 1 cannot be streamed.")
+	}
+	if err := checkIntRange("logprobs", r.Logprobs, 0, 5); err != nil {
+		return err
+	}
+	if err := checkStop(r.Stop); err != nil {
+		return err
+	}
+	return checkLogitBias(r.LogitBias)
+}
@@ -0,0 +1,65 @@
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// maxEmbeddingInputs is the largest input array the embeddings API accepts.
+const maxEmbeddingInputs = 2048
+
+// EmbeddingRequest is a /v1/embeddings request body.
+type EmbeddingRequest struct {
+	Model          string         `json:"model"`
+	Input          EmbeddingInput `json:"input"`
+	EncodingFormat string         `json:"encoding_format,omitempty"`
+	Dimensions     *int           `json:"dimensions,omitempty"`
+	User           string         `json:"user,omitempty"`
+}
+
+// EmbeddingInput is the text to embed, see TextInput.
+type EmbeddingInput struct {
+	TextInput
+}
+
+func (in *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	return in.decode(data, reflect.TypeOf(in).Elem(), "input")
+}
+
+// DecodeEmbeddingRequest parses an embeddings request body, translating JSON
+// errors into field-level API errors.
+func DecodeEmbeddingRequest(body []byte) (*EmbeddingRequest, *Error) {
+	var req EmbeddingRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, decodeError(err)
+	}
+	return &req, nil
+}
+
+// Validate checks the request against the shapes the OpenAI API accepts and
+// returns the first violation.
+func (r *EmbeddingRequest) Validate() *Error {
+	if r.Model == "" {
+		return InvalidRequest("model", "missing_required_parameter", "Missing required parameter: 'model'.")
+	}
+	if r.Input.Len() == 0 {
+		return InvalidRequest("input", "missing_required_parameter", "Missing required parameter: 'input'.")
+	}
+	if r.Input.Len() > maxEmbeddingInputs {
+		return InvalidRequest("input", "array_above_max_length", "Invalid 'input': array too long. Expected an array with maximum length %d, but got an array with length %d instead.", maxEmbeddingInputs, r.Input.Len())
+	}
+	for _, text := range r.Input.Texts {
+		if text == "" {
+			return InvalidRequest("input", "invalid_value", "Invalid 'input': empty strings cannot be embedded.")
+		}
+	}
+	for _, tokens := range r.Input.Tokens {
+		if len(tokens) == 0 {
+			return InvalidRequest("input", "invalid_value", "Invalid 'input': empty token arrays cannot be embedded.")
+		}
+	}
+	if r.EncodingFormat != "" && r.EncodingFormat != "float" && r.EncodingFormat != "base64" {
+		return InvalidRequest("encoding_format", "invalid_value", "Invalid value for 'encoding_format': expected 'float' or 'base64', got '%s'.", r.EncodingFormat)
+	}
+	return checkIntMin("dimensions", r.Dimensions, 1)
+}
@@ -0,0 +1,96 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Error is an API error in OpenAI's shape, so SDK clients can surface the
+// message and offending parameter.
+type Error struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// ErrorResponse is the {"error": {...}} envelope of an Error.
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// InvalidRequest builds an invalid_request_error for param.
+func InvalidRequest(param, code, format string, args ...any) *Error {
+	e := &Error{
+		Message: fmt.Sprintf(format, args...),
+		Type:    "invalid_request_error",
+	}
+	if param != "" {
+		e.Param = &param
+	}
+	if code != "" {
+		e.Code = &code
+	}
+	return e
+}
+
+// DecodeChatRequest parses a chat completion request body, translating JSON
+// errors into field-level API errors.
+func DecodeChatRequest(body []byte) (*ChatRequest, *Error) {
+	var req ChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, decodeError(err)
+	}
+	return &req, nil
+}
+
+func decodeError(err error) *Error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return InvalidRequest("", "invalid_type", "Invalid request body: expected %s, got %s.", describeType(typeErr.Type), typeErr.Value)
+		}
+		return InvalidRequest(typeErr.Field, "invalid_type", "Invalid type for '%s': expected %s, got %s.", typeErr.Field, describeType(typeErr.Type), typeErr.Value)
+	}
+	return InvalidRequest("", "invalid_json", "We could not parse the JSON body of your request: %v", err)
+}
+
+var unionTypes = map[reflect.Type]string{
+	reflect.TypeOf(Content{}):          "a string or an array of content parts",
+	reflect.TypeOf(Stop{}):             "a string or an array of strings",
+	reflect.TypeOf(ToolChoice{}):       `"none", "auto", "required" or a function object`,
+	reflect.TypeOf(EmbeddingInput{}):   "a string, an array of strings or an array of token arrays",
+	reflect.TypeOf(ResponsesInput{}):   "a string or an array of input items",
+	reflect.TypeOf(ResponsesContent{}): "a string or an array of content parts",
+	reflect.TypeOf(Prompt{}):           "a string, an array of strings or an array of token arrays",
+}
+
+func describeType(t reflect.Type) string {
+	if desc, ok := unionTypes[t]; ok {
+		return desc
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,56 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// TextInput is a string, an array of strings, an array of token IDs or an
+// array of token ID arrays, as accepted by the embeddings "input" and the
+// completions "prompt". Strings are collected in Texts and pre-tokenized
+// inputs in Tokens.
+type TextInput struct {
+	Texts  []string
+	Tokens [][]int
+}
+
+// Len returns the number of inputs.
+func (in TextInput) Len() int {
+	return len(in.Texts) + len(in.Tokens)
+}
+
+// decode parses data into in; t and field describe the wrapping type in type
+// errors.
+func (in *TextInput) decode(data []byte, t reflect.Type, field string) error {
+	data = bytes.TrimSpace(data)
+	*in = TextInput{}
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var one string
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		in.Texts = []string{one}
+		return nil
+	case len(data) > 0 && data[0] == '[':
+		var texts []string
+		if err := json.Unmarshal(data, &texts); err == nil {
+			in.Texts = texts
+			return nil
+		}
+		var tokens []int
+		if err := json.Unmarshal(data, &tokens); err == nil {
+			in.Tokens = [][]int{tokens}
+			return nil
+		}
+		if err := json.Unmarshal(data, &in.Tokens); err == nil {
+			return nil
+		}
+		return typeError(data, t, field)
+	default:
+		return typeError(data, t, field)
+	}
+}
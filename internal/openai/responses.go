@@ -0,0 +1,196 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ResponsesRequest is a /v1/responses request body. Tool, reasoning and text
+// configuration are kept raw: the gateway forwards the original bytes and
+// only inspects what it validates or meters.
+type ResponsesRequest struct {
+	Model              string            `json:"model"`
+	Input              ResponsesInput    `json:"input"`
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Stream             bool              `json:"stream,omitempty"`
+	MaxOutputTokens    *int              `json:"max_output_tokens,omitempty"`
+	Temperature        *float64          `json:"temperature,omitempty"`
+	TopP               *float64          `json:"top_p,omitempty"`
+	Tools              []json.RawMessage `json:"tools,omitempty"`
+	ToolChoice         json.RawMessage   `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool             `json:"parallel_tool_calls,omitempty"`
+	Reasoning          json.RawMessage   `json:"reasoning,omitempty"`
+	Text               json.RawMessage   `json:"text,omitempty"`
+	Store              *bool             `json:"store,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Truncation         string            `json:"truncation,omitempty"`
+	User               string            `json:"user,omitempty"`
+}
+
+// ResponsesInput is the request input: either a plain string (Text) or a list
+// of input items (Items).
+type ResponsesInput struct {
+	Text  string
+	Items []InputItem
+}
+
+func (in *ResponsesInput) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*in = ResponsesInput{}
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		in.Items = nil
+		return json.Unmarshal(data, &in.Text)
+	case len(data) > 0 && data[0] == '[':
+		in.Text = ""
+		in.Items = []InputItem{}
+		return json.Unmarshal(data, &in.Items)
+	default:
+		return typeError(data, reflect.TypeOf(in).Elem(), "input")
+	}
+}
+
+// InputItem is an item of the Responses input list. Messages (Type "message"
+// or empty) use Role and Content, function calls use CallID, Name and
+// Arguments, and function call outputs use CallID and Output. Other item
+// types are forwarded without inspection.
+type InputItem struct {
+	Type      string           `json:"type,omitempty"`
+	Role      string           `json:"role,omitempty"`
+	Content   ResponsesContent `json:"content,omitempty"`
+	CallID    string           `json:"call_id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Arguments string           `json:"arguments,omitempty"`
+	Output    json.RawMessage  `json:"output,omitempty"`
+}
+
+// OutputText returns a function call output as text. Structured outputs are
+// returned as their JSON.
+func (it InputItem) OutputText() string {
+	var text string
+	if err := json.Unmarshal(it.Output, &text); err == nil {
+		return text
+	}
+	return string(it.Output)
+}
+
+// ResponsesContent is a message's content: either a plain string (Text) or
+// an array of typed parts (Parts) such as input_text and input_image.
+type ResponsesContent struct {
+	Text  string
+	Parts []ResponsesPart
+}
+
+type ResponsesPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// String returns the text of the content, joining text parts.
+func (c ResponsesContent) String() string {
+	if c.Parts == nil {
+		return c.Text
+	}
+	var sb strings.Builder
+	for _, p := range c.Parts {
+		if p.Type == "input_text" || p.Type == "output_text" {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+func (c *ResponsesContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*c = ResponsesContent{}
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		c.Parts = nil
+		return json.Unmarshal(data, &c.Text)
+	case len(data) > 0 && data[0] == '[':
+		c.Text = ""
+		c.Parts = []ResponsesPart{}
+		return json.Unmarshal(data, &c.Parts)
+	default:
+		return typeError(data, reflect.TypeOf(c).Elem(), "input.content")
+	}
+}
+
+func (c ResponsesContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	return json.Marshal(c.Text)
+}
+
+// DecodeResponsesRequest parses a Responses API request body, translating
+// JSON errors into field-level API errors.
+func DecodeResponsesRequest(body []byte) (*ResponsesRequest, *Error) {
+	var req ResponsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, decodeError(err)
+	}
+	return &req, nil
+}
+
+var validInputRoles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+}
+
+// Validate checks the request against the ranges and shapes the OpenAI API
+// accepts and returns the first violation.
+func (r *ResponsesRequest) Validate() *Error {
+	if r.Model == "" {
+		return InvalidRequest("model", "missing_required_parameter", "Missing required parameter: 'model'.")
+	}
+	if r.Input.Text == "" && len(r.Input.Items) == 0 {
+		return InvalidRequest("input", "missing_required_parameter", "Missing required parameter: 'input'.")
+	}
+	for i, item := range r.Input.Items {
+		param := fmt.Sprintf("input[%d]", i)
+		switch item.Type {
+		case "", "message":
+			if !validInputRoles[item.Role] {
+				return InvalidRequest(param+".role", "invalid_value", "Invalid value for '%s.role': '%s' is not a supported role.", param, item.Role)
+			}
+		case "function_call":
+			if item.CallID == "" || item.Name == "" {
+				return InvalidRequest(param, "missing_required_parameter", "Invalid '%s': function calls require 'call_id' and 'name'.", param)
+			}
+		case "function_call_output":
+			if item.CallID == "" {
+				return InvalidRequest(param+".call_id", "missing_required_parameter", "Missing required parameter: '%s.call_id'.", param)
+			}
+		}
+	}
+
+	if err := checkIntMin("max_output_tokens", r.MaxOutputTokens, 16); err != nil {
+		return err
+	}
+	if err := checkRange("temperature", r.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := checkRange("top_p", r.TopP, 0, 1); err != nil {
+		return err
+	}
+	switch r.Truncation {
+	case "", "auto", "disabled":
+	default:
+		return InvalidRequest("truncation", "invalid_value", "Invalid value for 'truncation': expected 'auto' or 'disabled', got '%s'.", r.Truncation)
+	}
+	return nil
+}
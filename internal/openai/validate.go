@@ -0,0 +1,201 @@
+package openai
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var validRoles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+	"function":  true,
+}
+
+var validPartTypes = map[string]bool{
+	"text":        true,
+	"image_url":   true,
+	"input_audio": true,
+	"file":        true,
+	"refusal":     true,
+}
+
+// Validate checks the request against the ranges and shapes the OpenAI API
+// accepts and returns the first violation.
+func (r *ChatRequest) Validate() *Error {
+	if r.Model == "" {
+		return InvalidRequest("model", "missing_required_parameter", "Missing required parameter: 'model'.")
+	}
+	if len(r.Messages) == 0 {
+		return InvalidRequest("messages", "missing_required_parameter", "Missing required parameter: 'messages'.")
+	}
+	for i, m := range r.Messages {
+		if err := m.validate(fmt.Sprintf("messages[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	if r.StreamOptions != nil && !r.Stream {
+		return InvalidRequest("stream_options", "invalid_value", "The 'stream_options' parameter is only allowed when 'stream' is enabled.")
+	}
+	if err := checkIntMin("max_tokens", r.MaxTokens, 1); err != nil {
+		return err
+	}
+	if err := checkIntMin("max_completion_tokens", r.MaxCompletionTokens, 1); err != nil {
+		return err
+	}
+	if err := checkRange("temperature", r.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := checkRange("top_p", r.TopP, 0, 1); err != nil {
+		return err
+	}
+	if err := checkRange("presence_penalty", r.PresencePenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := checkRange("frequency_penalty", r.FrequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := checkIntRange("n", r.N, 1, 128); err != nil {
+		return err
+	}
+	if err := checkStop(r.Stop); err != nil {
+		return err
+	}
+	if err := checkLogitBias(r.LogitBias); err != nil {
+		return err
+	}
+	if r.TopLogprobs != nil {
+		if err := checkIntRange("top_logprobs", r.TopLogprobs, 0, 20); err != nil {
+			return err
+		}
+		if r.Logprobs == nil || !*r.Logprobs {
+			return InvalidRequest("top_logprobs", "invalid_value", "Invalid 'top_logprobs': 'logprobs' must be set to true.")
+		}
+	}
+
+	for i, tool := range r.Tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		if tool.Type != "function" {
+			return InvalidRequest(param+".type", "invalid_value", "Invalid value for '%s.type': expected 'function', got '%s'.", param, tool.Type)
+		}
+		if !functionNamePattern.MatchString(tool.Function.Name) {
+			return InvalidRequest(param+".function.name", "invalid_value", "Invalid '%s.function.name': must be 1-64 characters of a-z, A-Z, 0-9, underscores and dashes.", param)
+		}
+	}
+	if r.ToolChoice != nil {
+		if err := r.validateToolChoice(); err != nil {
+			return err
+		}
+	}
+
+	if f := r.ResponseFormat; f != nil {
+		switch f.Type {
+		case "text", "json_object":
+		case "json_schema":
+			if f.JSONSchema == nil || f.JSONSchema.Name == "" {
+				return InvalidRequest("response_format.json_schema.name", "missing_required_parameter", "Missing required parameter: 'response_format.json_schema.name'.")
+			}
+		default:
+			return InvalidRequest("response_format.type", "invalid_value", "Invalid value for 'response_format.type': expected 'text', 'json_object' or 'json_schema', got '%s'.", f.Type)
+		}
+	}
+	return nil
+}
+
+func (r *ChatRequest) validateToolChoice() *Error {
+	tc := r.ToolChoice
+	if tc.Function == "" {
+		switch tc.Mode {
+		case "none", "auto":
+		case "required":
+			if len(r.Tools) == 0 {
+				return InvalidRequest("tool_choice", "invalid_value", "Invalid 'tool_choice': 'required' is only allowed when 'tools' are specified.")
+			}
+		default:
+			return InvalidRequest("tool_choice", "invalid_value", "Invalid value for 'tool_choice': expected 'none', 'auto', 'required' or a function, got '%s'.", tc.Mode)
+		}
+		return nil
+	}
+
+	for _, tool := range r.Tools {
+		if tool.Function.Name == tc.Function {
+			return nil
+		}
+	}
+	return InvalidRequest("tool_choice", "invalid_value", "Invalid 'tool_choice': function '%s' is not among the provided tools.", tc.Function)
+}
+
+func (m *Message) validate(param string) *Error {
+	if !validRoles[m.Role] {
+		return InvalidRequest(param+".role", "invalid_value", "Invalid value for '%s.role': '%s' is not a supported role.", param, m.Role)
+	}
+	if m.Role == "tool" && m.ToolCallID == "" {
+		return InvalidRequest(param+".tool_call_id", "missing_required_parameter", "Missing required parameter: '%s.tool_call_id'.", param)
+	}
+	if len(m.ToolCalls) > 0 && m.Role != "assistant" {
+		return InvalidRequest(param+".tool_calls", "invalid_value", "Invalid '%s.tool_calls': only assistant messages may contain tool calls.", param)
+	}
+
+	for i, part := range m.Content.Parts {
+		partParam := fmt.Sprintf("%s.content[%d]", param, i)
+		if !validPartTypes[part.Type] {
+			return InvalidRequest(partParam+".type", "invalid_value", "Invalid value for '%s.type': '%s' is not a supported content part type.", partParam, part.Type)
+		}
+		if part.Type == "image_url" {
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return InvalidRequest(partParam+".image_url.url", "missing_required_parameter", "Missing required parameter: '%s.image_url.url'.", partParam)
+			}
+			switch part.ImageURL.Detail {
+			case "", "auto", "low", "high":
+			default:
+				return InvalidRequest(partParam+".image_url.detail", "invalid_value", "Invalid value for '%s.image_url.detail': expected 'auto', 'low' or 'high', got '%s'.", partParam, part.ImageURL.Detail)
+			}
+		}
+		if part.Type == "input_audio" && (part.InputAudio == nil || part.InputAudio.Data == "") {
+			return InvalidRequest(partParam+".input_audio.data", "missing_required_parameter", "Missing required parameter: '%s.input_audio.data'.", partParam)
+		}
+	}
+	return nil
+}
+
+func checkRange(param string, v *float64, lo, hi float64) *Error {
+	if v != nil && (*v < lo || *v > hi) {
+		return InvalidRequest(param, "invalid_value", "Invalid '%s': number must be between %g and %g, got %g.", param, lo, hi, *v)
+	}
+	return nil
+}
+
+func checkIntMin(param string, v *int, lo int) *Error {
+	if v != nil && *v < lo {
+		return InvalidRequest(param, "invalid_value", "Invalid '%s': integer must be at least %d, got %d.", param, lo, *v)
+	}
+	return nil
+}
+
+func checkIntRange(param string, v *int, lo, hi int) *Error {
+	if v != nil && (*v < lo || *v > hi) {
+		return InvalidRequest(param, "invalid_value", "Invalid '%s': integer must be between %d and %d, got %d.", param, lo, hi, *v)
+	}
+	return nil
+}
+
+func checkStop(stop Stop) *Error {
+	if len(stop) > 4 {
+		return InvalidRequest("stop", "invalid_value", "Invalid 'stop': array too long. Expected at most 4 sequences, got %d.", len(stop))
+	}
+	return nil
+}
+
+func checkLogitBias(bias map[string]float64) *Error {
+	for token, b := range bias {
+		if b < -100 || b > 100 {
+			return InvalidRequest("logit_bias", "invalid_value", "Invalid 'logit_bias' for token %s: value must be between -100 and 100, got %g.", token, b)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeChatRequest(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "What is"}, {"type": "text", "text": " this?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA", "detail": "low"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "42"}
+		],
+		"stop": "END",
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}},
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}},
+		"seed": 7, "n": 2, "logprobs": true, "top_logprobs": 3, "max_tokens": 100
+	}`
+
+	req, apiErr := DecodeChatRequest([]byte(body))
+	require.Nil(t, apiErr)
+	assert.Nil(t, req.Validate())
+
+	assert.Equal(t, "Be brief.", req.Messages[0].Content.String())
+	assert.Equal(t, "What is this?", req.Messages[1].Content.String())
+	assert.Len(t, req.Messages[1].Content.Parts, 3)
+	assert.Equal(t, "lookup", req.Messages[2].ToolCalls[0].Function.Name)
+	assert.Equal(t, Stop{"END"}, req.Stop)
+	assert.Equal(t, "lookup", req.ToolChoice.Function)
+	assert.Equal(t, int64(7), *req.Seed)
+
+	// Content keeps its original shape when re-encoded
+	out, err := json.Marshal(req.Messages[1].Content)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"text","text":"What is"},{"type":"text","text":" this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA","detail":"low"}}]`, string(out))
+}
+
+func TestDecodeChatRequest_TypeErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+	}{
+		{"Syntax Error", `{"model": `, ""},
+		{"Temperature As String", `{"model": "m", "temperature": "hot"}`, "temperature"},
+		{"Content As Number", `{"model": "m", "messages": [{"role": "user", "content": 5}]}`, "messages.content"},
+		{"Stop As Object", `{"model": "m", "stop": {}}`, "stop"},
+		{"Tool Choice As Number", `{"model": "m", "tool_choice": 1}`, "tool_choice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, apiErr := DecodeChatRequest([]byte(tt.body))
+			require.NotNil(t, apiErr)
+			assert.Equal(t, "invalid_request_error", apiErr.Type)
+			if tt.wantParam == "" {
+				assert.Nil(t, apiErr.Param)
+			} else if assert.NotNil(t, apiErr.Param) {
+				assert.Equal(t, tt.wantParam, *apiErr.Param)
+			}
+		})
+	}
+}
+
+func TestChatRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+	}{
+		{"Missing Model", `{"messages": [{"role": "user", "content": "hi"}]}`, "model"},
+		{"Missing Messages", `{"model": "m"}`, "messages"},
+		{"Unknown Role", `{"model": "m", "messages": [{"role": "robot", "content": "hi"}]}`, "messages[0].role"},
+		{"Tool Without Call ID", `{"model": "m", "messages": [{"role": "tool", "content": "42"}]}`, "messages[0].tool_call_id"},
+		{"Bad Part Type", `{"model": "m", "messages": [{"role": "user", "content": [{"type": "video"}]}]}`, "messages[0].content[0].type"},
+		{"Image Without URL", `{"model": "m", "messages": [{"role": "user", "content": [{"type": "image_url"}]}]}`, "messages[0].content[0].image_url.url"},
+		{"Temperature Too High", `{"model": "m", "temperature": 2.5, "messages": [{"role": "user", "content": "hi"}]}`, "temperature"},
+		{"Top P Negative", `{"model": "m", "top_p": -0.1, "messages": [{"role": "user", "content": "hi"}]}`, "top_p"},
+		{"N Zero", `{"model": "m", "n": 0, "messages": [{"role": "user", "content": "hi"}]}`, "n"},
+		{"Max Tokens Zero", `{"model": "m", "max_tokens": 0, "messages": [{"role": "user", "content": "hi"}]}`, "max_tokens"},
+		{"Too Many Stops", `{"model": "m", "stop": ["a","b","c","d","e"], "messages": [{"role": "user", "content": "hi"}]}`, "stop"},
+		{"Top Logprobs Without Logprobs", `{"model": "m", "top_logprobs": 2, "messages": [{"role": "user", "content": "hi"}]}`, "top_logprobs"},
+		{"Stream Options Without Stream", `{"model": "m", "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "hi"}]}`, "stream_options"},
+		{"Bad Tool Name", `{"model": "m", "tools": [{"type": "function", "function": {"name": "has space"}}], "messages": [{"role": "user", "content": "hi"}]}`, "tools[0].function.name"},
+		{"Required Without Tools", `{"model": "m", "tool_choice": "required", "messages": [{"role": "user", "content": "hi"}]}`, "tool_choice"},
+		{"Unknown Tool Choice", `{"model": "m", "tool_choice": {"type": "function", "function": {"name": "nope"}}, "messages": [{"role": "user", "content": "hi"}]}`, "tool_choice"},
+		{"Bad Response Format", `{"model": "m", "response_format": {"type": "xml"}, "messages": [{"role": "user", "content": "hi"}]}`, "response_format.type"},
+		{"Schema Without Name", `{"model": "m", "response_format": {"type": "json_schema"}, "messages": [{"role": "user", "content": "hi"}]}`, "response_format.json_schema.name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, apiErr := DecodeChatRequest([]byte(tt.body))
+			require.Nil(t, apiErr)
+
+			apiErr = req.Validate()
+			require.NotNil(t, apiErr)
+			if assert.NotNil(t, apiErr.Param) {
+				assert.Equal(t, tt.wantParam, *apiErr.Param)
+			}
+		})
+	}
+}
+
+func TestDecodeEmbeddingRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantTexts  []string
+		wantTokens [][]int
+		wantParam  string
+	}{
+		{"String", `{"model": "m", "input": "hi"}`, []string{"hi"}, nil, ""},
+		{"Strings", `{"model": "m", "input": ["a", "b"]}`, []string{"a", "b"}, nil, ""},
+		{"Token IDs", `{"model": "m", "input": [1, 2]}`, nil, [][]int{{1, 2}}, ""},
+		{"Token Arrays", `{"model": "m", "input": [[1], [2, 3]]}`, nil, [][]int{{1}, {2, 3}}, ""},
+		{"Object Input", `{"model": "m", "input": {}}`, nil, nil, "input"},
+		{"Mixed Array", `{"model": "m", "input": ["a", 1]}`, nil, nil, "input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, apiErr := DecodeEmbeddingRequest([]byte(tt.body))
+			if tt.wantParam != "" {
+				require.NotNil(t, apiErr)
+				assert.Equal(t, tt.wantParam, *apiErr.Param)
+				return
+			}
+			require.Nil(t, apiErr)
+			assert.Nil(t, req.Validate())
+			assert.Equal(t, tt.wantTexts, req.Input.Texts)
+			assert.Equal(t, tt.wantTokens, req.Input.Tokens)
+		})
+	}
+}
+
+func TestEmbeddingRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+	}{
+		{"Missing Model", `{"input": "hi"}`, "model"},
+		{"Missing Input", `{"model": "m"}`, "input"},
+		{"Empty String", `{"model": "m", "input": ["a", ""]}`, "input"},
+		{"Bad Encoding Format", `{"model": "m", "input": "hi", "encoding_format": "int8"}`, "encoding_format"},
+		{"Zero Dimensions", `{"model": "m", "input": "hi", "dimensions": 0}`, "dimensions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, apiErr := DecodeEmbeddingRequest([]byte(tt.body))
+			require.Nil(t, apiErr)
+
+			apiErr = req.Validate()
+			require.NotNil(t, apiErr)
+			assert.Equal(t, tt.wantParam, *apiErr.Param)
+		})
+	}
+}
+
+func TestCompletionRequest_Validate(t *testing.T) {
+	req, apiErr := DecodeCompletionRequest([]byte(`{"model": "m", "prompt": [[1, 2]], "best_of": 3, "n": 2, "stop": "\n"}`))
+	require.Nil(t, apiErr)
+	assert.Nil(t, req.Validate())
+	assert.Equal(t, [][]int{{1, 2}}, req.Prompt.Tokens)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+	}{
+		{"Missing Prompt", `{"model": "m"}`, "prompt"},
+		{"Best Of Below N", `{"model": "m", "prompt": "hi", "n": 3, "best_of": 2}`, "best_of"},
+		{"Streamed Best Of", `{"model": "m", "prompt": "hi", "stream": true, "best_of": 2}`, "best_of"},
+		{"Logprobs Too High", `{"model": "m", "prompt": "hi", "logprobs": 6}`, "logprobs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, apiErr := DecodeCompletionRequest([]byte(tt.body))
+			require.Nil(t, apiErr)
+
+			apiErr = req.Validate()
+			require.NotNil(t, apiErr)
+			assert.Equal(t, tt.wantParam, *apiErr.Param)
+		})
+	}
+}
+
+func TestResponsesRequest_Validate(t *testing.T) {
+	body := `{
+		"model": "m",
+		"instructions": "Be brief.",
+		"input": [
+			{"role": "user", "content": [{"type": "input_text", "text": "Look "}, {"type": "input_image", "image_url": "https://example.com/a.png"}, {"type": "input_text", "text": "here"}]},
+			{"type": "function_call", "call_id": "c1", "name": "lookup", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "c1", "output": "42"}
+		],
+		"tools": [{"type": "web_search"}],
+		"tool_choice": "auto",
+		"reasoning": {"effort": "low"}
+	}`
+	req, apiErr := DecodeResponsesRequest([]byte(body))
+	require.Nil(t, apiErr)
+	assert.Nil(t, req.Validate())
+	assert.Equal(t, "Look here", req.Input.Items[0].Content.String())
+	assert.Equal(t, "42", req.Input.Items[2].OutputText())
+
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+	}{
+		{"Missing Input", `{"model": "m"}`, "input"},
+		{"Bad Role", `{"model": "m", "input": [{"role": "tool", "content": "hi"}]}`, "input[0].role"},
+		{"Output Without Call ID", `{"model": "m", "input": [{"type": "function_call_output", "output": "42"}]}`, "input[0].call_id"},
+		{"Max Output Tokens Too Low", `{"model": "m", "input": "hi", "max_output_tokens": 8}`, "max_output_tokens"},
+		{"Bad Truncation", `{"model": "m", "input": "hi", "truncation": "sometimes"}`, "truncation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, apiErr := DecodeResponsesRequest([]byte(tt.body))
+			require.Nil(t, apiErr)
+
+			apiErr = req.Validate()
+			require.NotNil(t, apiErr)
+			assert.Equal(t, tt.wantParam, *apiErr.Param)
+		})
+	}
+
+	_, apiErr = DecodeResponsesRequest([]byte(`{"model": "m", "input": 1}`))
+	require.NotNil(t, apiErr)
+	assert.Equal(t, "input", *apiErr.Param)
+}
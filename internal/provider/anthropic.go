@@ -0,0 +1,379 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/llm-gateway/internal/openai"
+)
+
+const (
+	anthropicVersion = "2023-06-01"
+	// Anthropic requires max_tokens; this applies when the client sets none.
+	anthropicDefaultMaxTokens = 4096
+)
+
+type anthropicAdapter struct {
+	apiKey string
+	model  string // Upstream model ID; empty forwards the requested model
+}
+
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	System        string               `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Metadata      *anthropicMetadata   `json:"metadata,omitempty"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+// anthropicContentBlock is the union of text, image, tool_use and
+// tool_result blocks.
+type anthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+// toOpenAI maps Anthropic usage onto OpenAI's, where prompt_tokens includes
+// cached input.
+func (u anthropicUsage) toOpenAI() *chatUsage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	return newUsage(prompt, u.OutputTokens, u.CacheReadInputTokens, 0)
+}
+
+type anthropicStreamEvent struct {
+	Type         string                 `json:"type"`
+	Message      *anthropicResponse     `json:"message"`
+	Index        int                    `json:"index"`
+	ContentBlock *anthropicContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a *anthropicAdapter) BuildRequest(ctx context.Context, baseURL string, body []byte, header http.Header) (*http.Request, error) {
+	var chatReq openai.ChatRequest
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		return nil, fmt.Errorf("failed to decode chat request: %w", err)
+	}
+	if err := rejectParams(&chatReq, "n", "response_format", "logprobs", "top_logprobs", "seed", "presence_penalty", "frequency_penalty", "logit_bias"); err != nil {
+		return nil, err
+	}
+
+	msgReq := anthropicRequest{
+		Model:         chatReq.Model,
+		MaxTokens:     anthropicDefaultMaxTokens,
+		Temperature:   chatReq.Temperature,
+		TopP:          chatReq.TopP,
+		StopSequences: chatReq.Stop,
+		Stream:        chatReq.Stream,
+	}
+	if a.model != "" {
+		msgReq.Model = a.model
+	}
+	if limit := chatReq.MaxOutputTokens(); limit != nil {
+		msgReq.MaxTokens = *limit
+	}
+	if chatReq.User != "" {
+		msgReq.Metadata = &anthropicMetadata{UserID: chatReq.User}
+	}
+
+	// System prompts are a top-level field in the Messages API, and tool
+	// results are blocks of a user turn
+	var system []string
+	for i, m := range chatReq.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		switch m.Role {
+		case "system", "developer":
+			text, err := textContent(param, m.Content)
+			if err != nil {
+				return nil, err
+			}
+			system = append(system, text)
+		case "user", "assistant":
+			content, err := anthropicContent(param, m)
+			if err != nil {
+				return nil, err
+			}
+			msgReq.Messages = append(msgReq.Messages, anthropicMessage{Role: m.Role, Content: content})
+		case "tool":
+			text, err := textContent(param, m.Content)
+			if err != nil {
+				return nil, err
+			}
+			block := anthropicContentBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: text}
+			if i > 0 && chatReq.Messages[i-1].Role == "tool" {
+				last := &msgReq.Messages[len(msgReq.Messages)-1]
+				last.Content = append(last.Content, block)
+			} else {
+				msgReq.Messages = append(msgReq.Messages, anthropicMessage{Role: "user", Content: []anthropicContentBlock{block}})
+			}
+		default:
+			return nil, unsupported(param+".role", "Invalid value for '%s.role': '%s' messages are not supported by this model.", param, m.Role)
+		}
+	}
+	msgReq.System = strings.Join(system, "\n\n")
+
+	for _, tool := range chatReq.Tools {
+		msgReq.Tools = append(msgReq.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: toolSchema(tool.Function),
+		})
+	}
+	if len(msgReq.Tools) > 0 {
+		msgReq.ToolChoice = anthropicToolChoiceFor(chatReq.ToolChoice, chatReq.ParallelToolCalls)
+	}
+
+	payload, err := json.Marshal(msgReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode messages request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(baseURL, "/v1/messages"), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Del("Authorization")
+	// Let the transport negotiate compression since the body is re-encoded
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	return req, nil
+}
+
+// anthropicContent converts the content and tool calls of a user or
+// assistant message into content blocks.
+func anthropicContent(param string, m openai.Message) ([]anthropicContentBlock, error) {
+	var blocks []anthropicContentBlock
+	if m.Content.Parts == nil && (m.Content.Text != "" || len(m.ToolCalls) == 0) {
+		blocks = append(blocks, anthropicContentBlock{Type: "text", Text: m.Content.Text})
+	}
+	for j, part := range m.Content.Parts {
+		partParam := fmt.Sprintf("%s.content[%d]", param, j)
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+		case "image_url":
+			source := &anthropicImageSource{Type: "url", URL: part.ImageURL.URL}
+			if strings.HasPrefix(part.ImageURL.URL, "data:") {
+				mediaType, data, err := parseDataURL(partParam+".image_url.url", part.ImageURL.URL)
+				if err != nil {
+					return nil, err
+				}
+				source = &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: source})
+		default:
+			return nil, unsupported(partParam+".type", "Invalid value for '%s.type': '%s' parts are not supported by this model.", partParam, part.Type)
+		}
+	}
+	for j, call := range m.ToolCalls {
+		input, err := toolInput(fmt.Sprintf("%s.tool_calls[%d].function.arguments", param, j), call.Function.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, anthropicContentBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+	}
+	return blocks, nil
+}
+
+// anthropicToolChoiceFor maps tool_choice and parallel_tool_calls onto
+// Anthropic's tool_choice.
+func anthropicToolChoiceFor(choice *openai.ToolChoice, parallel *bool) *anthropicToolChoice {
+	tc := &anthropicToolChoice{Type: "auto"}
+	if choice != nil {
+		switch {
+		case choice.Function != "":
+			tc = &anthropicToolChoice{Type: "tool", Name: choice.Function}
+		case choice.Mode == "required":
+			tc.Type = "any"
+		case choice.Mode == "none":
+			tc.Type = "none"
+		}
+	}
+	if parallel != nil && !*parallel && tc.Type != "none" {
+		tc.DisableParallelToolUse = true
+	}
+	return tc
+}
+
+func (a *anthropicAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	var msg anthropicResponse
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("failed to decode messages response: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, chatToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: chatFunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+
+	finish := anthropicFinishReason(msg.StopReason)
+	return json.Marshal(chatCompletion{
+		ID:      msg.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   msg.Model,
+		Choices: []chatChoice{{
+			Message:      &chatMessage{Role: "assistant", Content: text.String(), ToolCalls: toolCalls},
+			FinishReason: &finish,
+		}},
+		Usage: msg.Usage.toOpenAI(),
+	})
+}
+
+func (a *anthropicAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return streamPipe(body, func(r io.Reader, emit func(v any) error) error {
+		var id, model string
+		var usage anthropicUsage
+		created := time.Now().Unix()
+		// Tool calls are numbered apart from the content blocks they stream in
+		toolCalls := make(map[int]int)
+
+		err := readSSEData(r, func(data []byte) (bool, error) {
+			var ev anthropicStreamEvent
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return false, fmt.Errorf("failed to decode stream event: %w", err)
+			}
+
+			switch ev.Type {
+			case "message_start":
+				if ev.Message != nil {
+					id, model, usage = ev.Message.ID, ev.Message.Model, ev.Message.Usage
+				}
+				return false, emit(newChunk(id, model, created, chatDelta{Role: "assistant"}, nil))
+			case "content_block_start":
+				if ev.ContentBlock != nil && ev.ContentBlock.Type == "tool_use" {
+					n := len(toolCalls)
+					toolCalls[ev.Index] = n
+					call := chatToolCall{Index: &n, ID: ev.ContentBlock.ID, Type: "function", Function: chatFunctionCall{Name: ev.ContentBlock.Name}}
+					return false, emit(newChunk(id, model, created, chatDelta{ToolCalls: []chatToolCall{call}}, nil))
+				}
+			case "content_block_delta":
+				switch ev.Delta.Type {
+				case "text_delta":
+					return false, emit(newChunk(id, model, created, chatDelta{Content: ev.Delta.Text}, nil))
+				case "input_json_delta":
+					if n, ok := toolCalls[ev.Index]; ok && ev.Delta.PartialJSON != "" {
+						call := chatToolCall{Index: &n, Function: chatFunctionCall{Arguments: ev.Delta.PartialJSON}}
+						return false, emit(newChunk(id, model, created, chatDelta{ToolCalls: []chatToolCall{call}}, nil))
+					}
+				}
+			case "message_delta":
+				if ev.Usage != nil {
+					usage.OutputTokens = ev.Usage.OutputTokens
+				}
+				if ev.Delta.StopReason != "" {
+					finish := anthropicFinishReason(ev.Delta.StopReason)
+					return false, emit(newChunk(id, model, created, chatDelta{}, &finish))
+				}
+			case "message_stop":
+				// Final usage chunk, as with stream_options.include_usage
+				return true, emit(newUsageChunk(id, model, created, usage.toOpenAI()))
+			case "error":
+				if ev.Error != nil {
+					return false, fmt.Errorf("upstream stream error (%s): %s", ev.Error.Type, ev.Error.Message)
+				}
+				return false, fmt.Errorf("upstream stream error")
+			}
+			return false, nil
+		})
+		if err == io.EOF {
+			// The stream ended without message_stop
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	})
+}
+
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
@@ -0,0 +1,258 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestAnthropic_BuildRequest(t *testing.T) {
+	a, err := New(&store.Model{ProviderName: "anthropic", UpstreamModel: "claude-3-5-sonnet-20241022"}, ChatCompletions, Credentials{APIKey: "sk-ant"})
+	require.NoError(t, err)
+
+	body := `{"model":"claude-sonnet","stream":true,"stop":"END","messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"hi"},
+		{"role":"assistant","content":"hello"},
+		{"role":"user","content":"bye"}]}`
+	header := http.Header{"Authorization": {"Bearer tenant-key"}, "X-Trace": {"abc"}}
+
+	req, err := a.BuildRequest(context.Background(), "https://api.anthropic.com/", []byte(body), header)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://api.anthropic.com/v1/messages", req.URL.String())
+	assert.Equal(t, "sk-ant", req.Header.Get("x-api-key"))
+	assert.Equal(t, anthropicVersion, req.Header.Get("anthropic-version"))
+	assert.Empty(t, req.Header.Get("Authorization"), "Tenant credentials must not reach the provider")
+	assert.Equal(t, "abc", req.Header.Get("X-Trace"))
+
+	var got anthropicRequest
+	payload, _ := io.ReadAll(req.Body)
+	require.NoError(t, json.Unmarshal(payload, &got))
+	assert.Equal(t, "claude-3-5-sonnet-20241022", got.Model)
+	assert.Equal(t, "Be brief.", got.System)
+	assert.Equal(t, anthropicDefaultMaxTokens, got.MaxTokens)
+	assert.Equal(t, []string{"END"}, got.StopSequences)
+	assert.True(t, got.Stream)
+	if assert.Len(t, got.Messages, 3) {
+		assert.Equal(t, anthropicMessage{Role: "user", Content: []anthropicContentBlock{{Type: "text", Text: "hi"}}}, got.Messages[0])
+		assert.Equal(t, "assistant", got.Messages[1].Role)
+	}
+	assert.Nil(t, got.Tools)
+	assert.Nil(t, got.ToolChoice)
+}
+
+func TestAnthropic_BuildRequest_Tools(t *testing.T) {
+	a := &anthropicAdapter{}
+	body := `{"model":"claude","tool_choice":"required","parallel_tool_calls":false,
+		"tools":[{"type":"function","function":{"name":"get_weather","description":"Weather by city","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}},
+			{"type":"function","function":{"name":"get_time"}}],
+		"messages":[
+		{"role":"user","content":[{"type":"text","text":"What is this?"},
+			{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},
+			{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]},
+		{"role":"assistant","content":null,"tool_calls":[
+			{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+			{"id":"toolu_2","type":"function","function":{"name":"get_time","arguments":""}}]},
+		{"role":"tool","tool_call_id":"toolu_1","content":"Sunny"},
+		{"role":"tool","tool_call_id":"toolu_2","content":"Noon"}]}`
+
+	req, err := a.BuildRequest(context.Background(), "https://api.anthropic.com", []byte(body), http.Header{})
+	require.NoError(t, err)
+
+	var got anthropicRequest
+	payload, _ := io.ReadAll(req.Body)
+	require.NoError(t, json.Unmarshal(payload, &got))
+
+	if assert.Len(t, got.Tools, 2) {
+		assert.Equal(t, "get_weather", got.Tools[0].Name)
+		assert.Equal(t, "Weather by city", got.Tools[0].Description)
+		assert.JSONEq(t, `{"type":"object","properties":{"city":{"type":"string"}}}`, string(got.Tools[0].InputSchema))
+		assert.JSONEq(t, `{"type":"object","properties":{}}`, string(got.Tools[1].InputSchema))
+	}
+	assert.Equal(t, &anthropicToolChoice{Type: "any", DisableParallelToolUse: true}, got.ToolChoice)
+
+	require.Len(t, got.Messages, 3)
+	assert.Equal(t, []anthropicContentBlock{
+		{Type: "text", Text: "What is this?"},
+		{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: "image/png", Data: "iVBORw0KGgo="}},
+		{Type: "image", Source: &anthropicImageSource{Type: "url", URL: "https://example.com/cat.jpg"}},
+	}, got.Messages[0].Content)
+	assert.Equal(t, []anthropicContentBlock{
+		{Type: "tool_use", ID: "toolu_1", Name: "get_weather", Input: json.RawMessage(`{"city":"Paris"}`)},
+		{Type: "tool_use", ID: "toolu_2", Name: "get_time", Input: json.RawMessage(`{}`)},
+	}, got.Messages[1].Content)
+	assert.Equal(t, anthropicMessage{Role: "user", Content: []anthropicContentBlock{
+		{Type: "tool_result", ToolUseID: "toolu_1", Content: "Sunny"},
+		{Type: "tool_result", ToolUseID: "toolu_2", Content: "Noon"},
+	}}, got.Messages[2], "Consecutive tool results share one user turn")
+}
+
+func TestAnthropic_BuildRequest_Unsupported(t *testing.T) {
+	a := &anthropicAdapter{}
+	for name, tc := range map[string]struct {
+		messages string
+		param    string
+	}{
+		"Audio":             {`[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]}]`, "messages[0].content[0].type"},
+		"Plain Data URL":    {`[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:text/plain,hi"}}]}]`, "messages[0].content[0].image_url.url"},
+		"Image Tool Result": {`[{"role":"tool","tool_call_id":"t","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,AA=="}}]}]`, "messages[0].content[0].type"},
+		"Bad Arguments":     {`[{"role":"assistant","tool_calls":[{"id":"t","type":"function","function":{"name":"f","arguments":"[1]"}}]}]`, "messages[0].tool_calls[0].function.arguments"},
+		"Function Role":     {`[{"role":"function","name":"f","content":"1"}]`, "messages[0].role"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.BuildRequest(context.Background(), "https://api.anthropic.com", []byte(`{"model":"claude","messages":`+tc.messages+`}`), http.Header{})
+			var apiErr *openai.Error
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, "invalid_request_error", apiErr.Type)
+			assert.Equal(t, tc.param, *apiErr.Param)
+		})
+	}
+}
+
+func TestAnthropic_BuildRequest_UnsupportedParams(t *testing.T) {
+	a := &anthropicAdapter{}
+	for param, value := range map[string]string{
+		"n":                 `3`,
+		"response_format":   `{"type":"json_object"}`,
+		"logprobs":          `true`,
+		"top_logprobs":      `2`,
+		"seed":              `42`,
+		"presence_penalty":  `0.5`,
+		"frequency_penalty": `-0.5`,
+		"logit_bias":        `{"50256":-100}`,
+	} {
+		t.Run(param, func(t *testing.T) {
+			body := `{"model":"claude","messages":[{"role":"user","content":"hi"}],"` + param + `":` + value + `}`
+			_, err := a.BuildRequest(context.Background(), "https://api.anthropic.com", []byte(body), http.Header{})
+			var apiErr *openai.Error
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, "unsupported_parameter", *apiErr.Code)
+			assert.Equal(t, param, *apiErr.Param)
+		})
+	}
+
+	// Defaults ask for nothing the model cannot do
+	body := `{"model":"claude","messages":[{"role":"user","content":"hi"}],"n":1,"response_format":{"type":"text"},"logprobs":false,"presence_penalty":0,"frequency_penalty":0,"logit_bias":{}}`
+	_, err := a.BuildRequest(context.Background(), "https://api.anthropic.com", []byte(body), http.Header{})
+	assert.NoError(t, err)
+}
+
+func TestAnthropic_TranslateResponse(t *testing.T) {
+	a := &anthropicAdapter{}
+	body := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-5-sonnet",
+		"content":[{"type":"text","text":"Hello"},{"type":"text","text":" World"},
+			{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],
+		"stop_reason":"max_tokens",
+		"usage":{"input_tokens":10,"output_tokens":2,"cache_read_input_tokens":5}}`
+
+	out, err := a.TranslateResponse([]byte(body))
+	require.NoError(t, err)
+
+	var got chatCompletion
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, "chat.completion", got.Object)
+	if assert.Len(t, got.Choices, 1) {
+		assert.Equal(t, "Hello World", got.Choices[0].Message.Content)
+		assert.Equal(t, []chatToolCall{{ID: "toolu_1", Type: "function", Function: chatFunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}, got.Choices[0].Message.ToolCalls)
+		assert.Equal(t, "length", *got.Choices[0].FinishReason)
+	}
+	assert.Equal(t, 15, got.Usage.PromptTokens)
+	assert.Equal(t, 2, got.Usage.CompletionTokens)
+	assert.Equal(t, 5, got.Usage.PromptTokensDetails.CachedTokens)
+}
+
+func TestAnthropic_TranslateStream(t *testing.T) {
+	a := &anthropicAdapter{}
+	upstream := strings.Join([]string{
+		"event: message_start",
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":25,"output_tokens":1}}}`,
+		"",
+		"event: ping",
+		`data: {"type":"ping"}`,
+		"",
+		"event: content_block_delta",
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		"",
+		"event: message_delta",
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+		"",
+		"event: message_stop",
+		`data: {"type":"message_stop"}`,
+		"",
+	}, "\n")
+
+	out, err := io.ReadAll(a.TranslateStream(io.NopCloser(strings.NewReader(upstream))))
+	require.NoError(t, err)
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Len(t, events, 5)
+	assert.Contains(t, events[0], `"role":"assistant"`)
+	assert.Contains(t, events[1], `"content":"Hello"`)
+	assert.Contains(t, events[2], `"finish_reason":"stop"`)
+	assert.Contains(t, events[3], `"usage":{"prompt_tokens":25,"completion_tokens":7,"total_tokens":32}`)
+	assert.Equal(t, "[DONE]", events[4])
+}
+
+func TestAnthropic_TranslateStream_ToolUse(t *testing.T) {
+	a := &anthropicAdapter{}
+	upstream := strings.Join([]string{
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":25}}}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+		`data: {"type":"message_stop"}`,
+	}, "\n\n") + "\n\n"
+
+	out, err := io.ReadAll(a.TranslateStream(io.NopCloser(strings.NewReader(upstream))))
+	require.NoError(t, err)
+
+	var calls []chatToolCall
+	var finish string
+	for _, line := range strings.Split(string(out), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk chatCompletion
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		for _, choice := range chunk.Choices {
+			calls = append(calls, choice.Delta.ToolCalls...)
+			if choice.FinishReason != nil {
+				finish = *choice.FinishReason
+			}
+		}
+	}
+
+	zero := 0
+	assert.Equal(t, []chatToolCall{
+		{Index: &zero, ID: "toolu_1", Type: "function", Function: chatFunctionCall{Name: "get_weather"}},
+		{Index: &zero, Function: chatFunctionCall{Arguments: `{"city":`}},
+		{Index: &zero, Function: chatFunctionCall{Arguments: `"Paris"}`}},
+	}, calls, "Tool calls are numbered from zero whatever their content block")
+	assert.Equal(t, "tool_calls", finish)
+}
+
+func TestAnthropic_TranslateStreamError(t *testing.T) {
+	a := &anthropicAdapter{}
+	upstream := `data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}` + "\n\n"
+
+	_, err := io.ReadAll(a.TranslateStream(io.NopCloser(strings.NewReader(upstream))))
+	assert.ErrorContains(t, err, "Overloaded")
+}
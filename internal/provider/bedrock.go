@@ -0,0 +1,439 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/google/uuid"
+	"github.com/user/llm-gateway/internal/openai"
+)
+
+// bedrockAdapter calls the Bedrock Runtime Converse API, signing requests
+// with SigV4 using the ambient AWS credentials (the ECS task role), so no
+// provider key is needed. BaseURLs hold the runtime endpoint, e.g.
+// https://bedrock-runtime.us-east-1.amazonaws.com.
+type bedrockAdapter struct {
+	aws    aws.Config
+	model  string // Bedrock model ID, also reported in responses
+	signer *v4.Signer
+}
+
+type bedrockRequest struct {
+	Messages        []bedrockMessage        `json:"messages"`
+	System          []bedrockContentBlock   `json:"system,omitempty"`
+	InferenceConfig *bedrockInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *bedrockToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type bedrockMessage struct {
+	Role    string                `json:"role"`
+	Content []bedrockContentBlock `json:"content"`
+}
+
+// bedrockContentBlock holds one of text, an image, a tool use or a tool
+// result.
+type bedrockContentBlock struct {
+	Text       string             `json:"text,omitempty"`
+	Image      *bedrockImage      `json:"image,omitempty"`
+	ToolUse    *bedrockToolUse    `json:"toolUse,omitempty"`
+	ToolResult *bedrockToolResult `json:"toolResult,omitempty"`
+}
+
+type bedrockImage struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes string `json:"bytes"` // Base64, as blobs are in JSON
+	} `json:"source"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input,omitempty"`
+}
+
+type bedrockToolResult struct {
+	ToolUseID string                `json:"toolUseId"`
+	Content   []bedrockContentBlock `json:"content"`
+}
+
+type bedrockToolConfig struct {
+	Tools      []bedrockTool      `json:"tools"`
+	ToolChoice *bedrockToolChoice `json:"toolChoice,omitempty"`
+}
+
+type bedrockTool struct {
+	ToolSpec struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		InputSchema struct {
+			JSON json.RawMessage `json:"json"`
+		} `json:"inputSchema"`
+	} `json:"toolSpec"`
+}
+
+// bedrockToolChoice sets exactly one of its fields.
+type bedrockToolChoice struct {
+	Auto *struct{}            `json:"auto,omitempty"`
+	Any  *struct{}            `json:"any,omitempty"`
+	Tool *bedrockSpecificTool `json:"tool,omitempty"`
+}
+
+type bedrockSpecificTool struct {
+	Name string `json:"name"`
+}
+
+type bedrockInferenceConfig struct {
+	MaxTokens     *int     `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type bedrockResponse struct {
+	Output struct {
+		Message bedrockMessage `json:"message"`
+	} `json:"output"`
+	StopReason string       `json:"stopReason"`
+	Usage      bedrockUsage `json:"usage"`
+}
+
+type bedrockUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+}
+
+// toOpenAI maps Bedrock usage onto OpenAI's, where prompt_tokens includes
+// cached input.
+func (u bedrockUsage) toOpenAI() *chatUsage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheWriteInputTokens
+	return newUsage(prompt, u.OutputTokens, u.CacheReadInputTokens, 0)
+}
+
+// bedrockStreamEvent is the union of ConverseStream event payloads.
+type bedrockStreamEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             *struct {
+		ToolUse *bedrockToolUse `json:"toolUse"`
+	} `json:"start"`
+	Delta *struct {
+		Text    string `json:"text"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse"`
+	} `json:"delta"`
+	StopReason string        `json:"stopReason"`
+	Usage      *bedrockUsage `json:"usage"`
+	Message    string        `json:"message"` // Exception payloads
+}
+
+func (a *bedrockAdapter) BuildRequest(ctx context.Context, baseURL string, body []byte, header http.Header) (*http.Request, error) {
+	var chatReq openai.ChatRequest
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		return nil, fmt.Errorf("failed to decode chat request: %w", err)
+	}
+	if err := rejectParams(&chatReq, "n", "response_format", "logprobs", "top_logprobs", "seed", "presence_penalty", "frequency_penalty", "logit_bias"); err != nil {
+		return nil, err
+	}
+
+	var convReq bedrockRequest
+	for i, m := range chatReq.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		switch m.Role {
+		case "system", "developer":
+			text, err := textContent(param, m.Content)
+			if err != nil {
+				return nil, err
+			}
+			convReq.System = append(convReq.System, bedrockContentBlock{Text: text})
+		case "user", "assistant":
+			content, err := bedrockContent(param, m)
+			if err != nil {
+				return nil, err
+			}
+			convReq.Messages = append(convReq.Messages, bedrockMessage{Role: m.Role, Content: content})
+		case "tool":
+			text, err := textContent(param, m.Content)
+			if err != nil {
+				return nil, err
+			}
+			// Tool results are blocks of a user turn
+			block := bedrockContentBlock{ToolResult: &bedrockToolResult{ToolUseID: m.ToolCallID, Content: []bedrockContentBlock{{Text: text}}}}
+			if i > 0 && chatReq.Messages[i-1].Role == "tool" {
+				last := &convReq.Messages[len(convReq.Messages)-1]
+				last.Content = append(last.Content, block)
+			} else {
+				convReq.Messages = append(convReq.Messages, bedrockMessage{Role: "user", Content: []bedrockContentBlock{block}})
+			}
+		default:
+			return nil, unsupported(param+".role", "Invalid value for '%s.role': '%s' messages are not supported by this model.", param, m.Role)
+		}
+	}
+	if len(chatReq.Tools) > 0 {
+		toolConfig, err := bedrockToolConfigFor(chatReq.Tools, chatReq.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		convReq.ToolConfig = toolConfig
+	}
+	convReq.InferenceConfig = &bedrockInferenceConfig{
+		MaxTokens:     chatReq.MaxOutputTokens(),
+		Temperature:   chatReq.Temperature,
+		TopP:          chatReq.TopP,
+		StopSequences: chatReq.Stop,
+	}
+
+	payload, err := json.Marshal(convReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode converse request: %w", err)
+	}
+
+	op := "/converse"
+	if chatReq.Stream {
+		op = "/converse-stream"
+	}
+	target := strings.TrimRight(baseURL, "/") + "/model/" + url.PathEscape(a.model) + op
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	// Only send what is signed; client headers are not forwarded to AWS
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if tp := header.Get("Traceparent"); tp != "" {
+		req.Header.Set("Traceparent", tp)
+	}
+
+	creds, err := a.aws.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(payload)
+	region := bedrockRegion(req.URL.Host, a.aws.Region)
+	if err := a.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "bedrock", region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+	return req, nil
+}
+
+// bedrockImageFormats maps the image media types Converse accepts to their
+// formats.
+var bedrockImageFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// bedrockContent converts the content and tool calls of a user or assistant
+// message into content blocks.
+func bedrockContent(param string, m openai.Message) ([]bedrockContentBlock, error) {
+	var blocks []bedrockContentBlock
+	if m.Content.Parts == nil && (m.Content.Text != "" || len(m.ToolCalls) == 0) {
+		blocks = append(blocks, bedrockContentBlock{Text: m.Content.Text})
+	}
+	for j, part := range m.Content.Parts {
+		partParam := fmt.Sprintf("%s.content[%d]", param, j)
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, bedrockContentBlock{Text: part.Text})
+		case "image_url":
+			// Converse takes image bytes, not URLs
+			mediaType, data, err := parseDataURL(partParam+".image_url.url", part.ImageURL.URL)
+			if err != nil {
+				return nil, err
+			}
+			format, ok := bedrockImageFormats[mediaType]
+			if !ok {
+				return nil, unsupported(partParam+".image_url.url", "Invalid '%s': '%s' images are not supported by this model; use PNG, JPEG, GIF or WebP.", partParam+".image_url.url", mediaType)
+			}
+			image := &bedrockImage{Format: format}
+			image.Source.Bytes = data
+			blocks = append(blocks, bedrockContentBlock{Image: image})
+		default:
+			return nil, unsupported(partParam+".type", "Invalid value for '%s.type': '%s' parts are not supported by this model.", partParam, part.Type)
+		}
+	}
+	for j, call := range m.ToolCalls {
+		input, err := toolInput(fmt.Sprintf("%s.tool_calls[%d].function.arguments", param, j), call.Function.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, bedrockContentBlock{ToolUse: &bedrockToolUse{ToolUseID: call.ID, Name: call.Function.Name, Input: input}})
+	}
+	return blocks, nil
+}
+
+// bedrockToolConfigFor maps tools and tool_choice onto a tool configuration.
+// Converse cannot forbid tool use, so tool_choice "none" is rejected.
+func bedrockToolConfigFor(tools []openai.Tool, choice *openai.ToolChoice) (*bedrockToolConfig, error) {
+	cfg := &bedrockToolConfig{}
+	for _, tool := range tools {
+		var t bedrockTool
+		t.ToolSpec.Name = tool.Function.Name
+		t.ToolSpec.Description = tool.Function.Description
+		t.ToolSpec.InputSchema.JSON = toolSchema(tool.Function)
+		cfg.Tools = append(cfg.Tools, t)
+	}
+
+	switch {
+	case choice == nil:
+	case choice.Function != "":
+		cfg.ToolChoice = &bedrockToolChoice{Tool: &bedrockSpecificTool{Name: choice.Function}}
+	case choice.Mode == "required":
+		cfg.ToolChoice = &bedrockToolChoice{Any: &struct{}{}}
+	case choice.Mode == "none":
+		return nil, unsupported("tool_choice", "Invalid value for 'tool_choice': 'none' is not supported by this model; omit 'tools' instead.")
+	default:
+		cfg.ToolChoice = &bedrockToolChoice{Auto: &struct{}{}}
+	}
+	return cfg, nil
+}
+
+// bedrockRegion extracts the region from a bedrock-runtime.<region>.amazonaws.com
+// host, falling back to the configured region for custom endpoints.
+func bedrockRegion(host, fallback string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 4 && strings.HasPrefix(parts[0], "bedrock-runtime") {
+		return parts[1]
+	}
+	return fallback
+}
+
+func (a *bedrockAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	var convResp bedrockResponse
+	if err := json.Unmarshal(body, &convResp); err != nil {
+		return nil, fmt.Errorf("failed to decode converse response: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, block := range convResp.Output.Message.Content {
+		text.WriteString(block.Text)
+		if use := block.ToolUse; use != nil {
+			toolCalls = append(toolCalls, chatToolCall{
+				ID:       use.ToolUseID,
+				Type:     "function",
+				Function: chatFunctionCall{Name: use.Name, Arguments: string(use.Input)},
+			})
+		}
+	}
+
+	// Converse responses carry no ID
+	finish := bedrockFinishReason(convResp.StopReason)
+	return json.Marshal(chatCompletion{
+		ID:      "chatcmpl-" + uuid.NewString(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   a.model,
+		Choices: []chatChoice{{
+			Message:      &chatMessage{Role: "assistant", Content: text.String(), ToolCalls: toolCalls},
+			FinishReason: &finish,
+		}},
+		Usage: convResp.Usage.toOpenAI(),
+	})
+}
+
+// TranslateStream decodes the AWS event-stream binary framing of
+// ConverseStream and re-emits each event as an OpenAI chunk.
+func (a *bedrockAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return streamPipe(body, func(r io.Reader, emit func(v any) error) error {
+		id, created := "chatcmpl-"+uuid.NewString(), time.Now().Unix()
+		decoder := eventstream.NewDecoder()
+		var payloadBuf []byte
+		// Tool calls are numbered apart from the content blocks they stream in
+		toolCalls := make(map[int]int)
+
+		for {
+			msg, err := decoder.Decode(r, payloadBuf)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					// The stream ended without its metadata event
+					return io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("failed to decode event stream: %w", err)
+			}
+			payloadBuf = msg.Payload[:0]
+
+			var ev bedrockStreamEvent
+			if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+				return fmt.Errorf("failed to decode stream event: %w", err)
+			}
+
+			if headerString(msg.Headers, ":message-type") == "exception" {
+				return fmt.Errorf("upstream stream error (%s): %s", headerString(msg.Headers, ":exception-type"), ev.Message)
+			}
+
+			switch headerString(msg.Headers, ":event-type") {
+			case "messageStart":
+				err = emit(newChunk(id, a.model, created, chatDelta{Role: "assistant"}, nil))
+			case "contentBlockStart":
+				if ev.Start != nil && ev.Start.ToolUse != nil {
+					n := len(toolCalls)
+					toolCalls[ev.ContentBlockIndex] = n
+					call := chatToolCall{Index: &n, ID: ev.Start.ToolUse.ToolUseID, Type: "function", Function: chatFunctionCall{Name: ev.Start.ToolUse.Name}}
+					err = emit(newChunk(id, a.model, created, chatDelta{ToolCalls: []chatToolCall{call}}, nil))
+				}
+			case "contentBlockDelta":
+				switch {
+				case ev.Delta == nil:
+				case ev.Delta.Text != "":
+					err = emit(newChunk(id, a.model, created, chatDelta{Content: ev.Delta.Text}, nil))
+				case ev.Delta.ToolUse != nil && ev.Delta.ToolUse.Input != "":
+					if n, ok := toolCalls[ev.ContentBlockIndex]; ok {
+						call := chatToolCall{Index: &n, Function: chatFunctionCall{Arguments: ev.Delta.ToolUse.Input}}
+						err = emit(newChunk(id, a.model, created, chatDelta{ToolCalls: []chatToolCall{call}}, nil))
+					}
+				}
+			case "messageStop":
+				finish := bedrockFinishReason(ev.StopReason)
+				err = emit(newChunk(id, a.model, created, chatDelta{}, &finish))
+			case "metadata":
+				// Metadata is the last event and carries usage
+				if ev.Usage != nil {
+					return emit(newUsageChunk(id, a.model, created, ev.Usage.toOpenAI()))
+				}
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func headerString(headers eventstream.Headers, name string) string {
+	if v := headers.Get(name); v != nil {
+		return v.String()
+	}
+	return ""
+}
+
+func bedrockFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "content_filtered", "guardrail_intervened":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
@@ -0,0 +1,242 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func testAWSConfig() *aws.Config {
+	return &aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}, nil
+		}),
+	}
+}
+
+func TestBedrock_BuildRequest(t *testing.T) {
+	_, err := New(&store.Model{ProviderName: "bedrock"}, ChatCompletions, Credentials{})
+	assert.Error(t, err, "Bedrock requires AWS credentials")
+
+	a, err := New(&store.Model{ProviderName: "bedrock", UpstreamModel: "anthropic.claude-3-haiku-20240307-v1:0"}, ChatCompletions, Credentials{AWS: testAWSConfig()})
+	require.NoError(t, err)
+
+	body := `{"model":"claude-haiku","stream":true,"max_tokens":100,"messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"hi"}]}`
+	header := http.Header{"Authorization": {"Bearer tenant-key"}}
+
+	req, err := a.BuildRequest(context.Background(), "https://bedrock-runtime.eu-west-1.amazonaws.com", []byte(body), header)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/model/anthropic.claude-3-haiku-20240307-v1:0/converse-stream", req.URL.Path)
+	auth := req.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+	assert.Contains(t, auth, "/eu-west-1/bedrock/aws4_request")
+	assert.Equal(t, "TOKEN", req.Header.Get("X-Amz-Security-Token"))
+
+	var got bedrockRequest
+	payload, _ := io.ReadAll(req.Body)
+	require.NoError(t, json.Unmarshal(payload, &got))
+	assert.Equal(t, "Be brief.", got.System[0].Text)
+	if assert.Len(t, got.Messages, 1) {
+		assert.Equal(t, "hi", got.Messages[0].Content[0].Text)
+	}
+	assert.Equal(t, 100, *got.InferenceConfig.MaxTokens)
+
+	// Without an upstream model the gateway's model ID is the Bedrock one
+	a, err = New(&store.Model{ModelID: "anthropic.claude-3-haiku-20240307-v1:0", ProviderName: "bedrock"}, ChatCompletions, Credentials{AWS: testAWSConfig()})
+	require.NoError(t, err)
+	req, err = a.BuildRequest(context.Background(), "https://bedrock-runtime.eu-west-1.amazonaws.com", []byte(`{"model":"anthropic.claude-3-haiku-20240307-v1:0","messages":[{"role":"user","content":"hi"}]}`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/model/anthropic.claude-3-haiku-20240307-v1:0/converse", req.URL.Path)
+	out, err := a.TranslateResponse([]byte(`{"output":{"message":{"role":"assistant","content":[{"text":"Hello"}]}},"stopReason":"end_turn"}`))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"model":"anthropic.claude-3-haiku-20240307-v1:0"`)
+}
+
+func TestBedrock_BuildRequest_Tools(t *testing.T) {
+	a := &bedrockAdapter{aws: *testAWSConfig(), model: "anthropic.claude-3-haiku", signer: v4.NewSigner()}
+	body := `{"model":"claude-haiku","tool_choice":"required",
+		"tools":[{"type":"function","function":{"name":"get_weather","description":"Weather by city"}}],
+		"messages":[
+		{"role":"user","content":[{"type":"text","text":"Here"},{"type":"image_url","image_url":{"url":"data:image/webp;base64,UklGRg=="}}]},
+		{"role":"assistant","content":"Checking.","tool_calls":[{"id":"tooluse_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","tool_call_id":"tooluse_1","content":"Sunny"}]}`
+
+	req, err := a.BuildRequest(context.Background(), "https://bedrock-runtime.us-east-1.amazonaws.com", []byte(body), nil)
+	require.NoError(t, err)
+
+	var got bedrockRequest
+	payload, _ := io.ReadAll(req.Body)
+	require.NoError(t, json.Unmarshal(payload, &got))
+
+	require.NotNil(t, got.ToolConfig)
+	if assert.Len(t, got.ToolConfig.Tools, 1) {
+		spec := got.ToolConfig.Tools[0].ToolSpec
+		assert.Equal(t, "get_weather", spec.Name)
+		assert.Equal(t, "Weather by city", spec.Description)
+		assert.JSONEq(t, `{"type":"object","properties":{}}`, string(spec.InputSchema.JSON))
+	}
+	assert.Equal(t, &bedrockToolChoice{Any: &struct{}{}}, got.ToolConfig.ToolChoice)
+
+	require.Len(t, got.Messages, 3)
+	if assert.Len(t, got.Messages[0].Content, 2) {
+		assert.Equal(t, "webp", got.Messages[0].Content[1].Image.Format)
+		assert.Equal(t, "UklGRg==", got.Messages[0].Content[1].Image.Source.Bytes)
+	}
+	assert.Equal(t, []bedrockContentBlock{
+		{Text: "Checking."},
+		{ToolUse: &bedrockToolUse{ToolUseID: "tooluse_1", Name: "get_weather", Input: json.RawMessage(`{"city":"Paris"}`)}},
+	}, got.Messages[1].Content)
+	assert.Equal(t, bedrockMessage{Role: "user", Content: []bedrockContentBlock{
+		{ToolResult: &bedrockToolResult{ToolUseID: "tooluse_1", Content: []bedrockContentBlock{{Text: "Sunny"}}}},
+	}}, got.Messages[2])
+}
+
+func TestBedrock_BuildRequest_Unsupported(t *testing.T) {
+	a := &bedrockAdapter{aws: *testAWSConfig(), model: "anthropic.claude-3-haiku", signer: v4.NewSigner()}
+	for name, tc := range map[string]struct {
+		body  string
+		param string
+	}{
+		"Remote Image": {`"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]}]`, "messages[0].content[0].image_url.url"},
+		"SVG Image":    {`"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/svg+xml;base64,PHN2Zz4="}}]}]`, "messages[0].content[0].image_url.url"},
+		"Audio":        {`"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]}]`, "messages[0].content[0].type"},
+		"No Tools":     {`"messages":[{"role":"user","content":"hi"}],"tool_choice":"none","tools":[{"type":"function","function":{"name":"f"}}]`, "tool_choice"},
+		"N":            {`"messages":[{"role":"user","content":"hi"}],"n":2`, "n"},
+		"JSON Mode":    {`"messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_object"}`, "response_format"},
+		"Logprobs":     {`"messages":[{"role":"user","content":"hi"}],"logprobs":true`, "logprobs"},
+		"Top Logprobs": {`"messages":[{"role":"user","content":"hi"}],"top_logprobs":2`, "top_logprobs"},
+		"Seed":         {`"messages":[{"role":"user","content":"hi"}],"seed":7`, "seed"},
+		"Presence":     {`"messages":[{"role":"user","content":"hi"}],"presence_penalty":1`, "presence_penalty"},
+		"Frequency":    {`"messages":[{"role":"user","content":"hi"}],"frequency_penalty":1`, "frequency_penalty"},
+		"Logit Bias":   {`"messages":[{"role":"user","content":"hi"}],"logit_bias":{"1":5}`, "logit_bias"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.BuildRequest(context.Background(), "https://bedrock-runtime.us-east-1.amazonaws.com", []byte(`{"model":"claude-haiku",`+tc.body+`}`), nil)
+			var apiErr *openai.Error
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tc.param, *apiErr.Param)
+		})
+	}
+}
+
+func TestBedrock_TranslateResponse(t *testing.T) {
+	a := &bedrockAdapter{model: "anthropic.claude-3-haiku"}
+	body := `{"output":{"message":{"role":"assistant","content":[{"text":"Hello"}]}},
+		"stopReason":"end_turn","usage":{"inputTokens":8,"outputTokens":2,"totalTokens":10}}`
+
+	out, err := a.TranslateResponse([]byte(body))
+	require.NoError(t, err)
+
+	var got chatCompletion
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.NotEmpty(t, got.ID)
+	assert.Equal(t, "anthropic.claude-3-haiku", got.Model)
+	assert.Equal(t, "Hello", got.Choices[0].Message.Content)
+	assert.Equal(t, "stop", *got.Choices[0].FinishReason)
+	assert.Equal(t, 8, got.Usage.PromptTokens)
+	assert.Equal(t, 2, got.Usage.CompletionTokens)
+}
+
+func encodeEvents(t *testing.T, events [][2]string) []byte {
+	var buf bytes.Buffer
+	enc := eventstream.NewEncoder()
+	for _, ev := range events {
+		var headers eventstream.Headers
+		headers.Set(":message-type", eventstream.StringValue("event"))
+		headers.Set(":event-type", eventstream.StringValue(ev[0]))
+		require.NoError(t, enc.Encode(&buf, eventstream.Message{Headers: headers, Payload: []byte(ev[1])}))
+	}
+	return buf.Bytes()
+}
+
+func TestBedrock_TranslateStream(t *testing.T) {
+	a := &bedrockAdapter{model: "anthropic.claude-3-haiku"}
+	upstream := encodeEvents(t, [][2]string{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hello"}}`},
+		{"contentBlockStop", `{"contentBlockIndex":0}`},
+		{"messageStop", `{"stopReason":"max_tokens"}`},
+		{"metadata", `{"usage":{"inputTokens":4,"outputTokens":1,"totalTokens":5},"metrics":{"latencyMs":10}}`},
+	})
+
+	out, err := io.ReadAll(a.TranslateStream(io.NopCloser(bytes.NewReader(upstream))))
+	require.NoError(t, err)
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Len(t, events, 5)
+	assert.Contains(t, events[0], `"role":"assistant"`)
+	assert.Contains(t, events[1], `"content":"Hello"`)
+	for _, ev := range events[:4] {
+		assert.Contains(t, ev, `"model":"anthropic.claude-3-haiku"`)
+	}
+	assert.Contains(t, events[2], `"finish_reason":"length"`)
+	assert.Contains(t, events[3], `"usage":{"prompt_tokens":4,"completion_tokens":1,"total_tokens":5}`)
+	assert.Equal(t, "[DONE]", events[4])
+}
+
+func TestBedrock_ToolUse(t *testing.T) {
+	a := &bedrockAdapter{model: "anthropic.claude-3-haiku"}
+	out, err := a.TranslateResponse([]byte(`{"output":{"message":{"role":"assistant","content":[
+		{"toolUse":{"toolUseId":"tooluse_1","name":"get_weather","input":{"city":"Paris"}}}]}},"stopReason":"tool_use"}`))
+	require.NoError(t, err)
+
+	var got chatCompletion
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, []chatToolCall{{ID: "tooluse_1", Type: "function", Function: chatFunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}, got.Choices[0].Message.ToolCalls)
+	assert.Equal(t, "tool_calls", *got.Choices[0].FinishReason)
+
+	upstream := encodeEvents(t, [][2]string{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Checking."}}`},
+		{"contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"get_weather"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"city\":\"Paris\"}"}}}`},
+		{"messageStop", `{"stopReason":"tool_use"}`},
+		{"metadata", `{"usage":{"inputTokens":4,"outputTokens":9,"totalTokens":13}}`},
+	})
+	out, err = io.ReadAll(a.TranslateStream(io.NopCloser(bytes.NewReader(upstream))))
+	require.NoError(t, err)
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Len(t, events, 7)
+	assert.Contains(t, events[2], `"tool_calls":[{"index":0,"id":"tooluse_1","type":"function","function":{"name":"get_weather","arguments":""}}]`)
+	assert.Contains(t, events[3], `"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]`)
+	assert.Contains(t, events[4], `"finish_reason":"tool_calls"`)
+}
+
+func TestBedrock_TranslateStreamException(t *testing.T) {
+	a := &bedrockAdapter{}
+	var buf bytes.Buffer
+	var headers eventstream.Headers
+	headers.Set(":message-type", eventstream.StringValue("exception"))
+	headers.Set(":exception-type", eventstream.StringValue("throttlingException"))
+	require.NoError(t, eventstream.NewEncoder().Encode(&buf, eventstream.Message{Headers: headers, Payload: []byte(`{"message":"Too many requests"}`)}))
+
+	_, err := io.ReadAll(a.TranslateStream(io.NopCloser(&buf)))
+	assert.ErrorContains(t, err, "throttlingException")
+}
@@ -0,0 +1,457 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/llm-gateway/internal/openai"
+)
+
+// geminiAdapter targets the Gemini API (generativelanguage.googleapis.com)
+// or, with vertex set, Vertex AI publisher models.
+//
+// Gemini BaseURLs hold the API root including the version (e.g.
+// https://generativelanguage.googleapis.com/v1beta) and authenticate with
+// x-goog-api-key. Vertex BaseURLs hold the location root (e.g.
+// https://us-central1-aiplatform.googleapis.com/v1/projects/p/locations/us-central1)
+// and authenticate with an OAuth access token read from APIKeyEnv.
+type geminiAdapter struct {
+	apiKey string
+	model  string // Upstream model ID; empty forwards the requested model
+	vertex bool
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart holds one of text, inline media, a function call or a
+// function response.
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"` // Only set by newer models
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string            `json:"name"`
+	Response map[string]string `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// parametersJsonSchema takes full JSON Schema, unlike parameters' OpenAPI subset
+	Parameters json.RawMessage `json:"parametersJsonSchema"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	CandidateCount   *int     `json:"candidateCount,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+	// responseJsonSchema takes full JSON Schema, unlike responseSchema's
+	// OpenAPI subset, which rejects the additionalProperties strict mode sets
+	ResponseSchema json.RawMessage `json:"responseJsonSchema,omitempty"`
+}
+
+type geminiResponse struct {
+	ResponseID    string               `json:"responseId"`
+	ModelVersion  string               `json:"modelVersion"`
+	Candidates    []geminiCandidate    `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata"`
+}
+
+type geminiCandidate struct {
+	Index        int           `json:"index"`
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+}
+
+// toOpenAI maps Gemini usage onto OpenAI's, where completion_tokens includes
+// reasoning ("thoughts") tokens.
+func (u *geminiUsageMetadata) toOpenAI() *chatUsage {
+	if u == nil {
+		return nil
+	}
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	return newUsage(u.PromptTokenCount, completion, u.CachedContentTokenCount, u.ThoughtsTokenCount)
+}
+
+func (c geminiCandidate) text() string {
+	var sb strings.Builder
+	for _, p := range c.Content.Parts {
+		sb.WriteString(p.Text)
+	}
+	return sb.String()
+}
+
+// toolCalls returns the candidate's function calls. Gemini matches results
+// to calls by name, so calls without an ID get one for the client to echo.
+func (c geminiCandidate) toolCalls() []chatToolCall {
+	var calls []chatToolCall
+	for _, p := range c.Content.Parts {
+		fc := p.FunctionCall
+		if fc == nil {
+			continue
+		}
+		call := chatToolCall{ID: fc.ID, Type: "function", Function: chatFunctionCall{Name: fc.Name, Arguments: string(fc.Args)}}
+		if call.ID == "" {
+			call.ID = "call_" + uuid.NewString()
+		}
+		if len(fc.Args) == 0 {
+			call.Function.Arguments = "{}"
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func (a *geminiAdapter) BuildRequest(ctx context.Context, baseURL string, body []byte, header http.Header) (*http.Request, error) {
+	var chatReq openai.ChatRequest
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		return nil, fmt.Errorf("failed to decode chat request: %w", err)
+	}
+	if err := rejectParams(&chatReq, "logprobs", "top_logprobs", "logit_bias"); err != nil {
+		return nil, err
+	}
+
+	var genReq geminiRequest
+	var system []geminiPart
+	// Function responses name the function rather than the call they answer
+	callNames := make(map[string]string)
+	for i, m := range chatReq.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		switch m.Role {
+		case "system", "developer":
+			text, err := textContent(param, m.Content)
+			if err != nil {
+				return nil, err
+			}
+			system = append(system, geminiPart{Text: text})
+		case "user", "assistant":
+			parts, err := geminiParts(param, m)
+			if err != nil {
+				return nil, err
+			}
+			role := "user"
+			if m.Role == "assistant" {
+				role = "model"
+			}
+			for _, call := range m.ToolCalls {
+				callNames[call.ID] = call.Function.Name
+			}
+			genReq.Contents = append(genReq.Contents, geminiContent{Role: role, Parts: parts})
+		case "tool":
+			text, err := textContent(param, m.Content)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := callNames[m.ToolCallID]
+			if !ok {
+				return nil, openai.InvalidRequest(param+".tool_call_id", "invalid_value", "Invalid '%s.tool_call_id': no earlier assistant message has tool call '%s'.", param, m.ToolCallID)
+			}
+			// Gemini expects the responses to a turn's calls in one turn
+			part := geminiPart{FunctionResponse: &geminiFunctionResponse{Name: name, Response: map[string]string{"output": text}}}
+			if i > 0 && chatReq.Messages[i-1].Role == "tool" {
+				last := &genReq.Contents[len(genReq.Contents)-1]
+				last.Parts = append(last.Parts, part)
+			} else {
+				genReq.Contents = append(genReq.Contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+			}
+		default:
+			return nil, unsupported(param+".role", "Invalid value for '%s.role': '%s' messages are not supported by this model.", param, m.Role)
+		}
+	}
+	if len(system) > 0 {
+		genReq.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(chatReq.Tools) > 0 {
+		var decls []geminiFunctionDeclaration
+		for _, tool := range chatReq.Tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  toolSchema(tool.Function),
+			})
+		}
+		genReq.Tools = []geminiTool{{FunctionDeclarations: decls}}
+		genReq.ToolConfig = geminiToolConfigFor(chatReq.ToolChoice)
+	}
+
+	genReq.GenerationConfig = &geminiGenerationConfig{
+		Temperature:      chatReq.Temperature,
+		TopP:             chatReq.TopP,
+		MaxOutputTokens:  chatReq.MaxOutputTokens(),
+		StopSequences:    chatReq.Stop,
+		CandidateCount:   chatReq.N,
+		Seed:             chatReq.Seed,
+		PresencePenalty:  chatReq.PresencePenalty,
+		FrequencyPenalty: chatReq.FrequencyPenalty,
+	}
+	if f := chatReq.ResponseFormat; f != nil && f.Type != "text" {
+		genReq.GenerationConfig.ResponseMimeType = "application/json"
+		if f.JSONSchema != nil {
+			genReq.GenerationConfig.ResponseSchema = f.JSONSchema.Schema
+		}
+	}
+
+	payload, err := json.Marshal(genReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode generateContent request: %w", err)
+	}
+
+	model := chatReq.Model
+	if a.model != "" {
+		model = a.model
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint(baseURL, model, chatReq.Stream), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Del("Authorization")
+	// Let the transport negotiate compression since the body is re-encoded
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Content-Type", "application/json")
+	if a.vertex {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	} else {
+		req.Header.Set("x-goog-api-key", a.apiKey)
+	}
+	return req, nil
+}
+
+// geminiParts converts the content and tool calls of a user or assistant
+// message into parts.
+func geminiParts(param string, m openai.Message) ([]geminiPart, error) {
+	var parts []geminiPart
+	if m.Content.Parts == nil && (m.Content.Text != "" || len(m.ToolCalls) == 0) {
+		parts = append(parts, geminiPart{Text: m.Content.Text})
+	}
+	for j, part := range m.Content.Parts {
+		partParam := fmt.Sprintf("%s.content[%d]", param, j)
+		switch part.Type {
+		case "text":
+			parts = append(parts, geminiPart{Text: part.Text})
+		case "image_url":
+			// Gemini fetches no URLs other than its own file URIs
+			mimeType, data, err := parseDataURL(partParam+".image_url.url", part.ImageURL.URL)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: mimeType, Data: data}})
+		case "input_audio":
+			parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: "audio/" + part.InputAudio.Format, Data: part.InputAudio.Data}})
+		default:
+			return nil, unsupported(partParam+".type", "Invalid value for '%s.type': '%s' parts are not supported by this model.", partParam, part.Type)
+		}
+	}
+	for j, call := range m.ToolCalls {
+		args, err := toolInput(fmt.Sprintf("%s.tool_calls[%d].function.arguments", param, j), call.Function.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+	}
+	return parts, nil
+}
+
+// geminiToolConfigFor maps tool_choice onto a function calling mode; nil
+// leaves it to the model.
+func geminiToolConfigFor(choice *openai.ToolChoice) *geminiToolConfig {
+	if choice == nil {
+		return nil
+	}
+	cfg := geminiFunctionCallingConfig{Mode: "AUTO"}
+	switch {
+	case choice.Function != "":
+		cfg = geminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{choice.Function}}
+	case choice.Mode == "required":
+		cfg.Mode = "ANY"
+	case choice.Mode == "none":
+		cfg.Mode = "NONE"
+	}
+	return &geminiToolConfig{FunctionCallingConfig: cfg}
+}
+
+func (a *geminiAdapter) endpoint(baseURL, model string, stream bool) string {
+	base := strings.TrimRight(baseURL, "/")
+	if a.vertex {
+		base += "/publishers/google"
+	}
+	u := base + "/models/" + url.PathEscape(model)
+	if stream {
+		return u + ":streamGenerateContent?alt=sse"
+	}
+	return u + ":generateContent"
+}
+
+func (a *geminiAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	var genResp geminiResponse
+	if err := json.Unmarshal(body, &genResp); err != nil {
+		return nil, fmt.Errorf("failed to decode generateContent response: %w", err)
+	}
+
+	choices := make([]chatChoice, 0, len(genResp.Candidates))
+	for _, cand := range genResp.Candidates {
+		calls := cand.toolCalls()
+		finish := geminiFinishReason(cand.FinishReason, len(calls) > 0)
+		choices = append(choices, chatChoice{
+			Index:        cand.Index,
+			Message:      &chatMessage{Role: "assistant", Content: cand.text(), ToolCalls: calls},
+			FinishReason: &finish,
+		})
+	}
+
+	return json.Marshal(chatCompletion{
+		ID:      genResp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   genResp.ModelVersion,
+		Choices: choices,
+		Usage:   genResp.UsageMetadata.toOpenAI(),
+	})
+}
+
+func (a *geminiAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return streamPipe(body, func(r io.Reader, emit func(v any) error) error {
+		var id, model string
+		var usage *geminiUsageMetadata
+		created := time.Now().Unix()
+		started, finished := false, false
+		// Function calls arrive whole; number them per candidate
+		toolCalls := make(map[int]int)
+
+		err := readSSEData(r, func(data []byte) (bool, error) {
+			var genResp geminiResponse
+			if err := json.Unmarshal(data, &genResp); err != nil {
+				return false, fmt.Errorf("failed to decode stream event: %w", err)
+			}
+			if genResp.ResponseID != "" {
+				id = genResp.ResponseID
+			}
+			if genResp.ModelVersion != "" {
+				model = genResp.ModelVersion
+			}
+			// usageMetadata is cumulative; the last one wins
+			if genResp.UsageMetadata != nil {
+				usage = genResp.UsageMetadata
+			}
+
+			chunk := chatCompletion{
+				ID:      id,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+			}
+			for _, cand := range genResp.Candidates {
+				delta := chatDelta{Content: cand.text(), ToolCalls: cand.toolCalls()}
+				if !started {
+					delta.Role = "assistant"
+				}
+				for i := range delta.ToolCalls {
+					n := toolCalls[cand.Index]
+					delta.ToolCalls[i].Index = &n
+					toolCalls[cand.Index]++
+				}
+				choice := chatChoice{Index: cand.Index, Delta: &delta}
+				if cand.FinishReason != "" {
+					_, called := toolCalls[cand.Index]
+					finish := geminiFinishReason(cand.FinishReason, called)
+					choice.FinishReason = &finish
+					finished = true
+				}
+				chunk.Choices = append(chunk.Choices, choice)
+			}
+			if len(chunk.Choices) == 0 {
+				return false, nil
+			}
+			started = true
+			return false, emit(chunk)
+		})
+		if err != io.EOF {
+			return err
+		}
+		if !finished {
+			// The stream ended before any candidate finished
+			return io.ErrUnexpectedEOF
+		}
+
+		// Gemini streams end at EOF; finish with the usage chunk
+		if usage != nil {
+			return emit(newUsageChunk(id, model, created, usage.toOpenAI()))
+		}
+		return nil
+	})
+}
+
+// geminiFinishReason maps a finishReason, which is STOP after function
+// calls too.
+func geminiFinishReason(reason string, calledTools bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if calledTools {
+		return "tool_calls"
+	}
+	return "stop"
+}
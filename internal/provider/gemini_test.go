@@ -0,0 +1,273 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestGemini_BuildRequest(t *testing.T) {
+	body := `{"model":"gemini-pro","stream":true,"max_tokens":256,"temperature":0.2,"messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"hi"},
+		{"role":"assistant","content":"hello"}]}`
+
+	tests := []struct {
+		name       string
+		model      *store.Model
+		baseURL    string
+		wantURL    string
+		wantHeader string
+	}{
+		{
+			name:       "Gemini API",
+			model:      &store.Model{ProviderName: "gemini", UpstreamModel: "gemini-1.5-pro"},
+			baseURL:    "https://generativelanguage.googleapis.com/v1beta/",
+			wantURL:    "https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-pro:streamGenerateContent?alt=sse",
+			wantHeader: "x-goog-api-key",
+		},
+		{
+			name:       "Vertex AI",
+			model:      &store.Model{ProviderName: "vertex"},
+			baseURL:    "https://us-central1-aiplatform.googleapis.com/v1/projects/p/locations/us-central1",
+			wantURL:    "https://us-central1-aiplatform.googleapis.com/v1/projects/p/locations/us-central1/publishers/google/models/gemini-pro:streamGenerateContent?alt=sse",
+			wantHeader: "Authorization",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(tt.model, ChatCompletions, Credentials{APIKey: "secret"})
+			require.NoError(t, err)
+
+			req, err := a.BuildRequest(context.Background(), tt.baseURL, []byte(body), http.Header{"Authorization": {"Bearer tenant-key"}})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantURL, req.URL.String())
+			assert.Contains(t, req.Header.Get(tt.wantHeader), "secret")
+
+			var got geminiRequest
+			payload, _ := io.ReadAll(req.Body)
+			require.NoError(t, json.Unmarshal(payload, &got))
+			assert.Equal(t, "Be brief.", got.SystemInstruction.Parts[0].Text)
+			if assert.Len(t, got.Contents, 2) {
+				assert.Equal(t, "user", got.Contents[0].Role)
+				assert.Equal(t, "model", got.Contents[1].Role)
+			}
+			assert.Equal(t, 256, *got.GenerationConfig.MaxOutputTokens)
+			assert.Equal(t, 0.2, *got.GenerationConfig.Temperature)
+		})
+	}
+}
+
+func TestGemini_BuildRequest_Tools(t *testing.T) {
+	a := &geminiAdapter{}
+	body := `{"model":"gemini","tool_choice":{"type":"function","function":{"name":"get_weather"}},
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}],
+		"messages":[
+		{"role":"user","content":[{"type":"text","text":"Here"},
+			{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,/9j/4AAQ"}},
+			{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]},
+		{"role":"assistant","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"Sunny"},
+		{"role":"tool","tool_call_id":"call_2","content":"Rain"}]}`
+
+	req, err := a.BuildRequest(context.Background(), "https://generativelanguage.googleapis.com/v1beta", []byte(body), http.Header{})
+	require.NoError(t, err)
+
+	var got geminiRequest
+	payload, _ := io.ReadAll(req.Body)
+	require.NoError(t, json.Unmarshal(payload, &got))
+
+	if assert.Len(t, got.Tools, 1) && assert.Len(t, got.Tools[0].FunctionDeclarations, 1) {
+		assert.Equal(t, "get_weather", got.Tools[0].FunctionDeclarations[0].Name)
+		assert.JSONEq(t, `{"type":"object","properties":{"city":{"type":"string"}}}`, string(got.Tools[0].FunctionDeclarations[0].Parameters))
+	}
+	assert.Equal(t, &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{"get_weather"}}}, got.ToolConfig)
+
+	require.Len(t, got.Contents, 3)
+	assert.Equal(t, []geminiPart{
+		{Text: "Here"},
+		{InlineData: &geminiBlob{MimeType: "image/jpeg", Data: "/9j/4AAQ"}},
+		{InlineData: &geminiBlob{MimeType: "audio/wav", Data: "UklGRg=="}},
+	}, got.Contents[0].Parts)
+	assert.Equal(t, geminiContent{Role: "model", Parts: []geminiPart{
+		{FunctionCall: &geminiFunctionCall{Name: "get_weather", Args: json.RawMessage(`{"city":"Paris"}`)}},
+		{FunctionCall: &geminiFunctionCall{Name: "get_weather", Args: json.RawMessage(`{"city":"Rome"}`)}},
+	}}, got.Contents[1])
+	assert.Equal(t, geminiContent{Role: "user", Parts: []geminiPart{
+		{FunctionResponse: &geminiFunctionResponse{Name: "get_weather", Response: map[string]string{"output": "Sunny"}}},
+		{FunctionResponse: &geminiFunctionResponse{Name: "get_weather", Response: map[string]string{"output": "Rain"}}},
+	}}, got.Contents[2], "The responses to one turn's calls share a turn")
+}
+
+func TestGemini_BuildRequest_Unsupported(t *testing.T) {
+	a := &geminiAdapter{}
+	for name, tc := range map[string]struct {
+		messages string
+		param    string
+	}{
+		"Remote Image": {`[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]}]`, "messages[0].content[0].image_url.url"},
+		"Unknown Call": {`[{"role":"user","content":"hi"},{"role":"tool","tool_call_id":"call_9","content":"1"}]`, "messages[1].tool_call_id"},
+		"File":         {`[{"role":"user","content":[{"type":"file"}]}]`, "messages[0].content[0].type"},
+		"Logprobs":     {`[{"role":"user","content":"hi"}],"logprobs":true`, "logprobs"},
+		"Top Logprobs": {`[{"role":"user","content":"hi"}],"top_logprobs":3`, "top_logprobs"},
+		"Logit Bias":   {`[{"role":"user","content":"hi"}],"logit_bias":{"1":5}`, "logit_bias"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.BuildRequest(context.Background(), "https://generativelanguage.googleapis.com/v1beta", []byte(`{"model":"gemini","messages":`+tc.messages+`}`), http.Header{})
+			var apiErr *openai.Error
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tc.param, *apiErr.Param)
+		})
+	}
+}
+
+func TestGemini_BuildRequest_GenerationConfig(t *testing.T) {
+	a := &geminiAdapter{}
+	seed, presence, frequency := int64(42), 0.5, -0.5
+	tests := []struct {
+		name   string
+		params string
+		want   geminiGenerationConfig
+	}{
+		{
+			name:   "Sampling",
+			params: `"seed":42,"presence_penalty":0.5,"frequency_penalty":-0.5`,
+			want:   geminiGenerationConfig{Seed: &seed, PresencePenalty: &presence, FrequencyPenalty: &frequency},
+		},
+		{
+			name:   "JSON Mode",
+			params: `"response_format":{"type":"json_object"}`,
+			want:   geminiGenerationConfig{ResponseMimeType: "application/json"},
+		},
+		{
+			name:   "JSON Schema",
+			params: `"response_format":{"type":"json_schema","json_schema":{"name":"city","strict":true,"schema":{"type":"object","properties":{"name":{"type":"string"}},"additionalProperties":false}}}`,
+			want: geminiGenerationConfig{
+				ResponseMimeType: "application/json",
+				ResponseSchema:   json.RawMessage(`{"type":"object","properties":{"name":{"type":"string"}},"additionalProperties":false}`),
+			},
+		},
+		{
+			name:   "Text",
+			params: `"response_format":{"type":"text"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"model":"gemini","messages":[{"role":"user","content":"hi"}],` + tt.params + `}`
+			req, err := a.BuildRequest(context.Background(), "https://generativelanguage.googleapis.com/v1beta", []byte(body), http.Header{})
+			require.NoError(t, err)
+
+			var got geminiRequest
+			payload, _ := io.ReadAll(req.Body)
+			require.NoError(t, json.Unmarshal(payload, &got))
+			assert.Equal(t, tt.want, *got.GenerationConfig)
+		})
+	}
+}
+
+func TestGemini_TranslateResponse(t *testing.T) {
+	a := &geminiAdapter{}
+	body := `{"responseId":"r1","modelVersion":"gemini-1.5-pro-002",
+		"candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"Hello"}]},"finishReason":"MAX_TOKENS"}],
+		"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":3,"thoughtsTokenCount":4,"cachedContentTokenCount":6}}`
+
+	out, err := a.TranslateResponse([]byte(body))
+	require.NoError(t, err)
+
+	var got chatCompletion
+	require.NoError(t, json.Unmarshal(out, &got))
+	if assert.Len(t, got.Choices, 1) {
+		assert.Equal(t, "Hello", got.Choices[0].Message.Content)
+		assert.Equal(t, "length", *got.Choices[0].FinishReason)
+	}
+	assert.Equal(t, 10, got.Usage.PromptTokens)
+	assert.Equal(t, 7, got.Usage.CompletionTokens)
+	assert.Equal(t, 6, got.Usage.PromptTokensDetails.CachedTokens)
+	assert.Equal(t, 4, got.Usage.CompletionTokensDetails.ReasoningTokens)
+}
+
+func TestGemini_TranslateStream(t *testing.T) {
+	a := &geminiAdapter{}
+	upstream := strings.Join([]string{
+		`data: {"responseId":"r1","candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":5}}`,
+		"",
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":2}}`,
+		"",
+	}, "\n")
+
+	out, err := io.ReadAll(a.TranslateStream(io.NopCloser(strings.NewReader(upstream))))
+	require.NoError(t, err)
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Len(t, events, 4)
+	assert.Contains(t, events[0], `"delta":{"role":"assistant","content":"Hel"}`)
+	assert.Contains(t, events[1], `"delta":{"content":"lo"},"finish_reason":"stop"`)
+	assert.Contains(t, events[2], `"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}`)
+	assert.Equal(t, "[DONE]", events[3])
+}
+
+func TestGemini_FunctionCalls(t *testing.T) {
+	a := &geminiAdapter{}
+	body := `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP"}]}`
+
+	out, err := a.TranslateResponse([]byte(body))
+	require.NoError(t, err)
+
+	var got chatCompletion
+	require.NoError(t, json.Unmarshal(out, &got))
+	require.Len(t, got.Choices, 1)
+	assert.Equal(t, "tool_calls", *got.Choices[0].FinishReason)
+	if assert.Len(t, got.Choices[0].Message.ToolCalls, 1) {
+		call := got.Choices[0].Message.ToolCalls[0]
+		assert.True(t, strings.HasPrefix(call.ID, "call_"), "Calls get an ID for the client to echo")
+		assert.Equal(t, chatFunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}, call.Function)
+	}
+
+	// Streamed calls are numbered across chunks, and finish as tool calls
+	upstream := strings.Join([]string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"fc_1","name":"get_weather","args":{"city":"Paris"}}}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"fc_2","name":"get_time"}}]},"finishReason":"STOP"}]}`,
+	}, "\n\n") + "\n\n"
+	out, err = io.ReadAll(a.TranslateStream(io.NopCloser(strings.NewReader(upstream))))
+	require.NoError(t, err)
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Len(t, events, 3)
+	assert.Contains(t, events[0], `"tool_calls":[{"index":0,"id":"fc_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]`)
+	assert.Contains(t, events[1], `"tool_calls":[{"index":1,"id":"fc_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]`)
+	assert.Contains(t, events[1], `"finish_reason":"tool_calls"`)
+}
+
+func TestGemini_TranslateStream_Truncated(t *testing.T) {
+	a := &geminiAdapter{}
+	upstream := `data: {"responseId":"r1","candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}` + "\n\n"
+
+	out, err := io.ReadAll(a.TranslateStream(io.NopCloser(strings.NewReader(upstream))))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Contains(t, string(out), `"content":"Hel"`, "Events before the cut are relayed")
+	assert.NotContains(t, string(out), "[DONE]")
+}
@@ -0,0 +1,237 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// OpenAI response types emitted by the translating adapters. Requests are
+// decoded with openai.ChatRequest.
+
+type chatMessage struct {
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+}
+
+// chatToolCall is a tool call of a message, or a fragment of one in a stream
+// delta, where Index identifies the call and only the first fragment carries
+// its ID, type and name.
+type chatToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function chatFunctionCall `json:"function"`
+}
+
+type chatFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int          `json:"index"`
+	Message      *chatMessage `json:"message,omitempty"`
+	Delta        *chatDelta   `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type chatDelta struct {
+	Role      string         `json:"role,omitempty"`
+	Content   string         `json:"content,omitempty"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+}
+
+type chatUsage struct {
+	PromptTokens            int                     `json:"prompt_tokens"`
+	CompletionTokens        int                     `json:"completion_tokens"`
+	TotalTokens             int                     `json:"total_tokens"`
+	PromptTokensDetails     *promptTokenDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *completionTokenDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type promptTokenDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type completionTokenDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// newUsage builds an OpenAI usage object. completion includes reasoning.
+func newUsage(prompt, completion, cached, reasoning int) *chatUsage {
+	u := &chatUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+	if cached > 0 {
+		u.PromptTokensDetails = &promptTokenDetails{CachedTokens: cached}
+	}
+	if reasoning > 0 {
+		u.CompletionTokensDetails = &completionTokenDetails{ReasoningTokens: reasoning}
+	}
+	return u
+}
+
+// newChunk builds a chat.completion.chunk carrying a single choice delta.
+func newChunk(id, model string, created int64, delta chatDelta, finishReason *string) chatCompletion {
+	return chatCompletion{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   model,
+		Choices: []chatChoice{{Delta: &delta, FinishReason: finishReason}},
+	}
+}
+
+// newUsageChunk builds the final choice-less chunk that carries usage, as
+// OpenAI sends with stream_options.include_usage.
+func newUsageChunk(id, model string, created int64, usage *chatUsage) chatCompletion {
+	return chatCompletion{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   model,
+		Choices: []chatChoice{},
+		Usage:   usage,
+	}
+}
+
+// Auth styles for OpenAI-compatible upstreams (store.Model.AuthStyle).
+const (
+	AuthBearer  = "bearer"    // Authorization: Bearer <key>
+	AuthAPIKey  = "api-key"   // api-key: <key> (Azure OpenAI)
+	AuthXAPIKey = "x-api-key" // x-api-key: <key>
+	AuthNone    = "none"
+)
+
+const (
+	azureURLTemplate = "{base_url}/openai/deployments/{deployment}/chat/completions?api-version={api_version}"
+	azureAPIVersion  = "2024-10-21"
+)
+
+// openAIAdapter forwards OpenAI-compatible traffic unchanged. The upstream
+// URL is either the base URL itself or built from a template, which is how
+// Azure OpenAI deployments are addressed. Both point at the chat completions
+// endpoint; other APIs are served from the same upstream.
+type openAIAdapter struct {
+	api         API
+	apiKey      string
+	authStyle   string
+	urlTemplate string
+	model       string // Upstream model or Azure deployment name
+	apiVersion  string
+}
+
+func newOpenAIAdapter(model *store.Model, api API, apiKey, authStyle, urlTemplate, apiVersion string) *openAIAdapter {
+	a := &openAIAdapter{
+		api:         api,
+		apiKey:      apiKey,
+		authStyle:   authStyle,
+		urlTemplate: urlTemplate,
+		model:       model.UpstreamModel,
+		apiVersion:  apiVersion,
+	}
+	if model.AuthStyle != "" {
+		a.authStyle = strings.ToLower(model.AuthStyle)
+	}
+	if model.URLTemplate != "" {
+		a.urlTemplate = model.URLTemplate
+	}
+	if model.APIVersion != "" {
+		a.apiVersion = model.APIVersion
+	}
+	return a
+}
+
+func (a *openAIAdapter) BuildRequest(ctx context.Context, baseURL string, body []byte, header http.Header) (*http.Request, error) {
+	target := baseURL
+	if a.urlTemplate != "" {
+		model := a.model
+		if model == "" {
+			var req struct {
+				Model string `json:"model"`
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				return nil, fmt.Errorf("failed to decode request: %w", err)
+			}
+			model = req.Model
+		}
+		target = expandURL(a.urlTemplate, baseURL, model, a.apiVersion)
+	}
+	target, err := apiURL(target, a.api)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Del("Authorization")
+	switch a.authStyle {
+	case AuthAPIKey:
+		req.Header.Set("api-key", a.apiKey)
+	case AuthXAPIKey:
+		req.Header.Set("x-api-key", a.apiKey)
+	case AuthNone:
+	default:
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+	return req, nil
+}
+
+// apiURL points target, a chat completions URL, at api on the same upstream:
+// a trailing /chat/completions path is replaced by api's path, otherwise the
+// path is appended. The query string is kept.
+func apiURL(target string, api API) (string, error) {
+	if api == ChatCompletions {
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream URL: %w", err)
+	}
+	path := strings.TrimSuffix(strings.TrimRight(u.Path, "/"), string(ChatCompletions))
+	u.Path = path + string(api)
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// expandURL fills the {base_url}, {model}, {deployment} and {api_version}
+// placeholders of tmpl. {deployment} is an alias of {model}.
+func expandURL(tmpl, baseURL, model, apiVersion string) string {
+	return strings.NewReplacer(
+		"{base_url}", strings.TrimRight(baseURL, "/"),
+		"{model}", url.PathEscape(model),
+		"{deployment}", url.PathEscape(model),
+		"{api_version}", url.QueryEscape(apiVersion),
+	).Replace(tmpl)
+}
+
+func (a *openAIAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (a *openAIAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return body
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestOpenAI_BuildRequest(t *testing.T) {
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		name       string
+		model      *store.Model
+		baseURL    string
+		wantURL    string
+		wantHeader string
+		wantValue  string
+	}{
+		{
+			name:       "OpenAI Passthrough",
+			model:      &store.Model{ModelID: "gpt-4o"},
+			baseURL:    "https://api.openai.com/v1/chat/completions",
+			wantURL:    "https://api.openai.com/v1/chat/completions",
+			wantHeader: "Authorization",
+			wantValue:  "Bearer secret",
+		},
+		{
+			name:       "Azure Deployment",
+			model:      &store.Model{ModelID: "gpt-4o", ProviderName: "azure", UpstreamModel: "gpt4o-prod"},
+			baseURL:    "https://myres.openai.azure.com/",
+			wantURL:    "https://myres.openai.azure.com/openai/deployments/gpt4o-prod/chat/completions?api-version=" + azureAPIVersion,
+			wantHeader: "api-key",
+			wantValue:  "secret",
+		},
+		{
+			name:       "Azure Custom Version Without Deployment",
+			model:      &store.Model{ModelID: "gpt-4o", ProviderName: "azure", APIVersion: "2025-01-01-preview"},
+			baseURL:    "https://myres.openai.azure.com",
+			wantURL:    "https://myres.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2025-01-01-preview",
+			wantHeader: "api-key",
+			wantValue:  "secret",
+		},
+		{
+			name:       "Custom Template And Auth Style",
+			model:      &store.Model{ModelID: "llama", AuthStyle: "x-api-key", URLTemplate: "{base_url}/v2/{model}/chat"},
+			baseURL:    "http://vllm.internal:8000",
+			wantURL:    "http://vllm.internal:8000/v2/gpt-4o/chat",
+			wantHeader: "x-api-key",
+			wantValue:  "secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(tt.model, ChatCompletions, Credentials{APIKey: "secret"})
+			require.NoError(t, err)
+
+			header := http.Header{"Authorization": {"Bearer tenant-key"}}
+			req, err := a.BuildRequest(context.Background(), tt.baseURL, []byte(body), header)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantURL, req.URL.String())
+			assert.Equal(t, tt.wantValue, req.Header.Get(tt.wantHeader))
+			if tt.wantHeader != "Authorization" {
+				assert.Empty(t, req.Header.Get("Authorization"), "Tenant credentials must not reach the provider")
+			}
+
+			// The body is forwarded unchanged
+			payload, _ := io.ReadAll(req.Body)
+			assert.Equal(t, body, string(payload))
+		})
+	}
+}
+
+func TestOpenAI_BuildRequestForAPI(t *testing.T) {
+	body := `{"model":"text-embedding-3-small","input":"hi"}`
+
+	tests := []struct {
+		name    string
+		model   *store.Model
+		baseURL string
+		wantURL string
+	}{
+		{
+			name:    "Chat Endpoint Rewritten",
+			model:   &store.Model{ModelID: "text-embedding-3-small"},
+			baseURL: "https://api.openai.com/v1/chat/completions",
+			wantURL: "https://api.openai.com/v1/embeddings",
+		},
+		{
+			name:    "API Root Appended",
+			model:   &store.Model{ModelID: "text-embedding-3-small"},
+			baseURL: "http://vllm.internal:8000/v1/",
+			wantURL: "http://vllm.internal:8000/v1/embeddings",
+		},
+		{
+			name:    "Azure Deployment",
+			model:   &store.Model{ModelID: "text-embedding-3-small", ProviderName: "azure", UpstreamModel: "embed-prod"},
+			baseURL: "https://myres.openai.azure.com",
+			wantURL: "https://myres.openai.azure.com/openai/deployments/embed-prod/embeddings?api-version=" + azureAPIVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(tt.model, Embeddings, Credentials{APIKey: "secret"})
+			require.NoError(t, err)
+
+			req, err := a.BuildRequest(context.Background(), tt.baseURL, []byte(body), http.Header{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantURL, req.URL.String())
+		})
+	}
+
+	_, err := New(&store.Model{ProviderName: "anthropic"}, Embeddings, Credentials{})
+	assert.ErrorIs(t, err, ErrUnsupportedAPI)
+}
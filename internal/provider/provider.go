@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/sse"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// Provider names accepted in store.Model.ProviderName.
+const (
+	OpenAI    = "openai"
+	Azure     = "azure"
+	Anthropic = "anthropic"
+	Gemini    = "gemini"
+	Vertex    = "vertex"
+	Bedrock   = "bedrock"
+)
+
+// API identifies an OpenAI endpoint by its path below /v1.
+type API string
+
+const (
+	ChatCompletions API = "/chat/completions"
+	Completions     API = "/completions"
+	Embeddings      API = "/embeddings"
+	Responses       API = "/responses"
+)
+
+// ErrUnsupportedAPI is returned by New when the provider cannot serve the
+// requested API. Only OpenAI-compatible providers serve APIs other than chat
+// completions.
+var ErrUnsupportedAPI = errors.New("API not supported by provider")
+
+// Adapter translates OpenAI chat-completion traffic to and from a provider's
+// native API, so clients keep speaking the OpenAI format regardless of the
+// upstream.
+type Adapter interface {
+	// BuildRequest creates the upstream request for body, an OpenAI request
+	// for the adapter's API. header holds the client headers to forward.
+	// Requests the provider cannot express fail with an *openai.Error.
+	BuildRequest(ctx context.Context, baseURL string, body []byte, header http.Header) (*http.Request, error)
+	// TranslateResponse converts a successful non-streaming upstream body into
+	// an OpenAI chat.completion body.
+	TranslateResponse(body []byte) ([]byte, error)
+	// TranslateStream converts a successful streaming upstream body into
+	// OpenAI chat.completion.chunk SSE events terminated by "data: [DONE]".
+	TranslateStream(body io.ReadCloser) io.ReadCloser
+}
+
+// Credentials carries what adapters need to authenticate upstream.
+type Credentials struct {
+	// APIKey is resolved from store.Model.APIKeyEnv.
+	APIKey string
+	// AWS signs Bedrock requests. Bedrock models fail without it.
+	AWS *aws.Config
+}
+
+// New returns the adapter that serves api with model's provider.
+func New(model *store.Model, api API, creds Credentials) (Adapter, error) {
+	name := strings.ToLower(model.ProviderName)
+	switch name {
+	case "", OpenAI:
+		return newOpenAIAdapter(model, api, creds.APIKey, AuthBearer, "", ""), nil
+	case Azure:
+		return newOpenAIAdapter(model, api, creds.APIKey, AuthAPIKey, azureURLTemplate, azureAPIVersion), nil
+	}
+
+	if api != ChatCompletions {
+		return nil, fmt.Errorf("%w: %s does not serve %s", ErrUnsupportedAPI, model.ProviderName, api)
+	}
+	switch name {
+	case Anthropic:
+		return &anthropicAdapter{apiKey: creds.APIKey, model: model.UpstreamModel}, nil
+	case Gemini:
+		return &geminiAdapter{apiKey: creds.APIKey, model: model.UpstreamModel}, nil
+	case Vertex:
+		return &geminiAdapter{apiKey: creds.APIKey, model: model.UpstreamModel, vertex: true}, nil
+	case Bedrock:
+		if creds.AWS == nil {
+			return nil, fmt.Errorf("bedrock provider requires AWS credentials")
+		}
+		// Converse responses do not name the model, so resolve it here
+		upstream := model.UpstreamModel
+		if upstream == "" {
+			upstream = model.ModelID
+		}
+		return &bedrockAdapter{aws: *creds.AWS, model: upstream, signer: v4.NewSigner()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported provider %q", model.ProviderName)
+	}
+}
+
+// endpoint appends path to baseURL unless it is already there, so BaseURLs
+// may hold either the API root or the full endpoint.
+func endpoint(baseURL, path string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if strings.HasSuffix(baseURL, path) {
+		return baseURL
+	}
+	return baseURL + path
+}
+
+// unsupported rejects a request value the provider has no equivalent for,
+// rather than dropping it.
+func unsupported(param, format string, args ...any) *openai.Error {
+	return openai.InvalidRequest(param, "unsupported_value", format, args...)
+}
+
+// chatParamSet reports, per chat parameter, whether a request sets it to
+// anything but OpenAI's default.
+var chatParamSet = map[string]func(r *openai.ChatRequest) bool{
+	"n":                 func(r *openai.ChatRequest) bool { return r.N != nil && *r.N != 1 },
+	"response_format":   func(r *openai.ChatRequest) bool { return r.ResponseFormat != nil && r.ResponseFormat.Type != "text" },
+	"logprobs":          func(r *openai.ChatRequest) bool { return r.Logprobs != nil && *r.Logprobs },
+	"top_logprobs":      func(r *openai.ChatRequest) bool { return r.TopLogprobs != nil && *r.TopLogprobs != 0 },
+	"seed":              func(r *openai.ChatRequest) bool { return r.Seed != nil },
+	"presence_penalty":  func(r *openai.ChatRequest) bool { return r.PresencePenalty != nil && *r.PresencePenalty != 0 },
+	"frequency_penalty": func(r *openai.ChatRequest) bool { return r.FrequencyPenalty != nil && *r.FrequencyPenalty != 0 },
+	"logit_bias":        func(r *openai.ChatRequest) bool { return len(r.LogitBias) > 0 },
+}
+
+// rejectParams fails with the first of params that r sets, for chat
+// parameters the provider has no equivalent for.
+func rejectParams(r *openai.ChatRequest, params ...string) error {
+	for _, param := range params {
+		if chatParamSet[param](r) {
+			return openai.InvalidRequest(param, "unsupported_parameter", "Unsupported parameter: '%s' is not supported by this model.", param)
+		}
+	}
+	return nil
+}
+
+// textContent returns the text of content that may only hold text, such as
+// a system prompt or a tool result.
+func textContent(param string, content openai.Content) (string, error) {
+	for i, part := range content.Parts {
+		if part.Type != "text" {
+			partParam := fmt.Sprintf("%s.content[%d]", param, i)
+			return "", unsupported(partParam+".type", "Invalid '%s.type': this message may only contain text parts, got '%s'.", partParam, part.Type)
+		}
+	}
+	return content.String(), nil
+}
+
+// parseDataURL splits a base64 data URL ("data:image/png;base64,...") into
+// its media type and data.
+func parseDataURL(param, u string) (mediaType, data string, err error) {
+	rest, ok := strings.CutPrefix(u, "data:")
+	if ok {
+		var meta string
+		meta, data, ok = strings.Cut(rest, ",")
+		mediaType, _, _ = strings.Cut(meta, ";")
+		ok = ok && mediaType != "" && strings.HasSuffix(meta, ";base64")
+	}
+	if !ok {
+		return "", "", unsupported(param, "Invalid '%s': this model only accepts base64-encoded data URLs.", param)
+	}
+	return mediaType, data, nil
+}
+
+// toolInput returns the arguments of a tool call, which OpenAI encodes as a
+// JSON string, as the object providers expect.
+func toolInput(param, arguments string) (json.RawMessage, error) {
+	if strings.TrimSpace(arguments) == "" {
+		return json.RawMessage("{}"), nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &obj); err != nil || obj == nil {
+		return nil, openai.InvalidRequest(param, "invalid_value", "Invalid '%s': expected a JSON object.", param)
+	}
+	return json.RawMessage(arguments), nil
+}
+
+// toolSchema returns the JSON Schema of a function's parameters. Functions
+// without parameters take an empty object.
+func toolSchema(fn openai.Function) json.RawMessage {
+	if len(fn.Parameters) == 0 || string(fn.Parameters) == "null" {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return fn.Parameters
+}
+
+// streamPipe runs translate in the background and exposes what it emits as
+// OpenAI SSE. The upstream body is closed when translation ends, and closing
+// the returned reader stops the translation.
+func streamPipe(body io.ReadCloser, translate func(r io.Reader, emit func(v any) error) error) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		err := translate(body, func(v any) error {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(pw, "data: %s\n\n", data)
+			return err
+		})
+		if err == nil {
+			_, err = io.WriteString(pw, "data: [DONE]\n\n")
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// readSSEData calls fn with the data of every event in r until fn reports
+// done (nil is returned), fn fails, or r is exhausted (io.EOF).
+func readSSEData(r io.Reader, fn func(data []byte) (done bool, err error)) error {
+	events := sse.NewReader(r)
+	for {
+		ev, err := events.Next()
+		if err != nil {
+			return err
+		}
+		if ev.Data == nil {
+			continue
+		}
+		done, err := fn(ev.Data)
+		if err != nil || done {
+			return err
+		}
+	}
+}
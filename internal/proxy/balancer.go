@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"github.com/user/llm-gateway/internal/balancer"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// balancerRegistry holds the load balancer of each model, rebuilt when the
+// model's endpoints or strategy change.
+type balancerRegistry struct {
+	mu        sync.Mutex
+	balancers map[string]*modelBalancer
+}
+
+type modelBalancer struct {
+	lb        *balancer.Balancer
+	strategy  string
+	endpoints []balancer.Endpoint
+}
+
+func newBalancerRegistry() *balancerRegistry {
+	return &balancerRegistry{balancers: make(map[string]*modelBalancer)}
+}
+
+// get returns the balancer for model. Unknown strategies fall back to
+// failover so a typo in the model table does not take the model down.
+func (r *balancerRegistry) get(model *store.Model) *balancer.Balancer {
+	endpoints := make([]balancer.Endpoint, len(model.BaseURLs))
+	for i, u := range model.BaseURLs {
+		cfg := model.Endpoints[u]
+		endpoints[i] = balancer.Endpoint{URL: u, Weight: cfg.Weight, Priority: cfg.Priority}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.balancers[model.ModelID]; ok && b.strategy == model.LoadBalancing && reflect.DeepEqual(b.endpoints, endpoints) {
+		return b.lb
+	}
+	lb, err := balancer.New(model.LoadBalancing, endpoints)
+	if err != nil {
+		slog.Warn("Invalid load balancing strategy, using failover", "model", model.ModelID, "error", err)
+		lb, _ = balancer.New(balancer.Failover, endpoints)
+	}
+	r.balancers[model.ModelID] = &modelBalancer{lb: lb, strategy: model.LoadBalancing, endpoints: endpoints}
+	return lb
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestCreateCompletion_LoadBalancing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var failing atomic.Bool
+	newUpstream := func(hits *atomic.Int32, primary bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			if primary && failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+		}))
+	}
+	var hitsA, hitsB, hitsBackup atomic.Int32
+	a, b, backup := newUpstream(&hitsA, true), newUpstream(&hitsB, true), newUpstream(&hitsBackup, false)
+	defer a.Close()
+	defer b.Close()
+	defer backup.Close()
+
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {
+				ModelID:       "gpt-4",
+				BaseURLs:      []string{a.URL, b.URL, backup.URL},
+				LoadBalancing: "weighted_round_robin",
+				Endpoints: map[string]store.EndpointConfig{
+					a.URL:      {Weight: 3},
+					backup.URL: {Priority: 1},
+				},
+			},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 1*time.Second)
+
+	send := func() int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}]}`))
+		c.Request.Header.Set("X-LLM-Retry-Backoff-Ms", "0")
+		c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+		h.CreateCompletion(c)
+		return w.Code
+	}
+
+	// Traffic is split by weight across the primary tier
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, http.StatusOK, send())
+	}
+	assert.Equal(t, int32(6), hitsA.Load())
+	assert.Equal(t, int32(2), hitsB.Load())
+	assert.Equal(t, int32(0), hitsBackup.Load(), "Backup tier is idle while the primary tier is healthy")
+
+	// The backup tier serves once the primary tier fails
+	failing.Store(true)
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, int32(1), hitsBackup.Load())
+	assert.NoError(t, h.Shutdown(context.Background()))
+}
+
+type fakeHealth map[string]bool
+
+func (f fakeHealth) Healthy(modelID, baseURL string) bool {
+	healthy, ok := f[baseURL]
+	return !ok || healthy
+}
+
+func TestCreateCompletion_SkipsUnhealthyEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var hitsA, hitsB atomic.Int32
+	newUpstream := func(hits *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+		}))
+	}
+	a, b := newUpstream(&hitsA), newUpstream(&hitsB)
+	defer a.Close()
+	defer b.Close()
+
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{a.URL, b.URL}},
+		},
+	}
+	health := fakeHealth{a.URL: false}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 1*time.Second, WithHealthChecker(health))
+
+	send := func() int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}]}`))
+		c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+		h.CreateCompletion(c)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, int32(0), hitsA.Load(), "Unhealthy first endpoint is skipped")
+	assert.Equal(t, int32(1), hitsB.Load())
+
+	// With every endpoint unhealthy the candidates are tried anyway
+	health[b.URL] = false
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, int32(1), hitsA.Load())
+	assert.NoError(t, h.Shutdown(context.Background()))
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"github.com/user/llm-gateway/internal/middleware"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// Breaker defaults, used for store.BreakerConfig fields left at zero.
+const (
+	defaultBreakerMinRequests      = 10
+	defaultBreakerFailureRatio     = 0.6
+	defaultBreakerInterval         = 60 * time.Second
+	defaultBreakerOpenTimeout      = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 5
+)
+
+// breakerRegistry holds a circuit breaker per model endpoint (model and base
+// URL), so a failing upstream only stops traffic to itself.
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[breakerKey]*endpointBreaker
+}
+
+type breakerKey struct {
+	model   string
+	baseURL string
+}
+
+type endpointBreaker struct {
+	cb *gobreaker.TwoStepCircuitBreaker
+	// config the breaker was built from, to rebuild it when the model changes
+	config store.BreakerConfig
+}
+
+func newBreakerRegistry() *breakerRegistry {
+	return &breakerRegistry{breakers: make(map[breakerKey]*endpointBreaker)}
+}
+
+// get returns the breaker of model's baseURL, creating it on first use.
+func (r *breakerRegistry) get(model *store.Model, baseURL string) *gobreaker.TwoStepCircuitBreaker {
+	var config store.BreakerConfig
+	if model.CircuitBreaker != nil {
+		config = *model.CircuitBreaker
+	}
+	key := breakerKey{model: model.ModelID, baseURL: baseURL}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.breakers[key]; ok && b.config == config {
+		return b.cb
+	}
+	b := &endpointBreaker{cb: newEndpointBreaker(key, config), config: config}
+	r.breakers[key] = b
+	middleware.RecordCircuitBreakerState(key.model, key.baseURL, int(gobreaker.StateClosed))
+	return b.cb
+}
+
+func newEndpointBreaker(key breakerKey, config store.BreakerConfig) *gobreaker.TwoStepCircuitBreaker {
+	minRequests := config.MinRequests
+	if minRequests == 0 {
+		minRequests = defaultBreakerMinRequests
+	}
+	tripRatio := config.FailureRatio
+	if tripRatio == 0 {
+		tripRatio = defaultBreakerFailureRatio
+	}
+	interval := defaultBreakerInterval
+	if config.IntervalSeconds > 0 {
+		interval = time.Duration(config.IntervalSeconds) * time.Second
+	}
+	openTimeout := defaultBreakerOpenTimeout
+	if config.OpenSeconds > 0 {
+		openTimeout = time.Duration(config.OpenSeconds) * time.Second
+	}
+	halfOpenRequests := config.HalfOpenRequests
+	if halfOpenRequests == 0 {
+		halfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	return gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        key.model + " " + key.baseURL,
+		MaxRequests: halfOpenRequests,
+		Interval:    interval,
+		Timeout:     openTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
+			return counts.Requests >= minRequests && failureRatio >= tripRatio
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			middleware.RecordCircuitBreakerState(key.model, key.baseURL, int(to))
+		},
+	})
+}
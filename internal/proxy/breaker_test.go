@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestBreakerRegistry(t *testing.T) {
+	r := newBreakerRegistry()
+	model := &store.Model{ModelID: "gpt-4"}
+
+	a := r.get(model, "http://a")
+	assert.Same(t, a, r.get(model, "http://a"), "Breakers should be reused per endpoint")
+	assert.NotSame(t, a, r.get(model, "http://b"))
+	assert.NotSame(t, a, r.get(&store.Model{ModelID: "gpt-4o"}, "http://a"), "Models should not share breakers")
+
+	// Changed thresholds rebuild the breaker
+	model.CircuitBreaker = &store.BreakerConfig{MinRequests: 1}
+	assert.NotSame(t, a, r.get(model, "http://a"))
+}
+
+func TestCreateCompletion_PerUpstreamBreaker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var badHits, goodHits atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badHits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodHits.Add(1)
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer good.Close()
+
+	tripFast := &store.BreakerConfig{MinRequests: 1, FailureRatio: 0.5, OpenSeconds: 60}
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"flaky":  {ModelID: "flaky", BaseURLs: []string{bad.URL, good.URL}, CircuitBreaker: tripFast},
+			"broken": {ModelID: "broken", BaseURLs: []string{bad.URL}, CircuitBreaker: tripFast},
+			"other":  {ModelID: "other", BaseURLs: []string{good.URL}},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 1*time.Second)
+
+	send := func(model string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "`+model+`", "messages": [{"role": "user", "content": "hi"}]}`))
+		c.Request.Header.Set("X-LLM-Retry-Backoff-Ms", "0")
+		c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+		h.CreateCompletion(c)
+		return w.Code
+	}
+
+	// First request trips the bad endpoint and fails over to the good one
+	assert.Equal(t, http.StatusOK, send("flaky"))
+	assert.Equal(t, int32(1), badHits.Load())
+	assert.Equal(t, gobreaker.StateOpen, h.breakers.get(mockModel.Models["flaky"], bad.URL).State())
+
+	// Later requests skip the open endpoint instead of retrying it
+	assert.Equal(t, http.StatusOK, send("flaky"))
+	assert.Equal(t, int32(1), badHits.Load())
+	assert.Equal(t, int32(2), goodHits.Load())
+
+	// Breakers are per model: the first request reaches the bad endpoint and
+	// trips it, after which a model without open endpoints fails fast
+	assert.Equal(t, http.StatusServiceUnavailable, send("broken"))
+	assert.Equal(t, int32(2), badHits.Load())
+	assert.Equal(t, http.StatusServiceUnavailable, send("broken"))
+	assert.Equal(t, int32(2), badHits.Load())
+
+	// Other models are unaffected
+	assert.Equal(t, http.StatusOK, send("other"))
+	assert.NoError(t, h.Shutdown(context.Background()))
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/provider"
+)
+
+// CreateTextCompletion proxies the legacy prompt-based /v1/completions API
+// through the same pipeline as chat completions.
+func (h *Handler) CreateTextCompletion(c *gin.Context) {
+	start := time.Now()
+	tenant, ok := tenantFromContext(c)
+	if !ok {
+		return
+	}
+
+	bodyBytes, ok := readBody(c, tenant)
+	if !ok {
+		return
+	}
+
+	compReq, apiErr := openai.DecodeCompletionRequest(bodyBytes)
+	if apiErr != nil {
+		slog.Warn("Invalid JSON body", "error", apiErr, "tenant_id", tenant.TenantID)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	logger := slog.With("tenant_id", tenant.TenantID, "model", compReq.Model)
+
+	if !modelAllowed(tenant, compReq.Model) {
+		logger.Warn("Model not allowed for this tenant")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this tenant"})
+		return
+	}
+
+	if apiErr := compReq.Validate(); apiErr != nil {
+		logger.Warn("Invalid completion request", "error", apiErr)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	requested, adapter, ok := h.resolveModel(c, logger, compReq.Model, provider.Completions)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquireSlot(c, logger, tenant, compReq.Model)
+	if !ok {
+		return
+	}
+	defer release()
+
+	tok := h.tokenizers.Get(requested.Tokenizer)
+	inputTokens := countCompletionPrompt(tok, compReq)
+	reserved := inputTokens + outputReservation(compReq.MaxTokens, compReq.N, compReq.BestOf)
+	if !h.reserveTokens(c, logger, tenant, compReq.Model, reserved) {
+		return
+	}
+
+	modelConfig, adapter, resp, ok := h.dispatch(c, logger, tenant, requested, adapter, provider.Completions, bodyBytes, compReq.Stream)
+	if !ok {
+		h.refundTokens(tenant, compReq.Model, reserved)
+		return
+	}
+	defer resp.Body.Close()
+
+	latency := time.Since(start)
+	logger.Info("Proxy request completed", "status", resp.StatusCode, "latency_ms", latency.Milliseconds())
+
+	copyResponseHeaders(c, resp)
+
+	if modelConfig.Tokenizer != requested.Tokenizer {
+		tok = h.tokenizers.Get(modelConfig.Tokenizer)
+		inputTokens = countCompletionPrompt(tok, compReq)
+	}
+	usage := h.relayResponse(c, logger, resp, adapter, compReq.Stream, tenant.TenantID, modelConfig, start, tok, inputTokens, completionFormat)
+
+	h.recordUsage(c, tenant, reserved, compReq.Model, modelConfig.ModelID, start, usage)
+}
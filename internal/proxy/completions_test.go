@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-gateway/internal/store"
+	"github.com/user/llm-gateway/internal/tokenizer"
+)
+
+func TestCompletionsAndResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	est := tokenizer.Estimator{}
+
+	tests := []struct {
+		name        string
+		path        string
+		requestBody string
+		response    string
+		wantPath    string
+		wantSource  string
+		wantIn      int
+		wantOut     int
+		wantCached  int
+	}{
+		{
+			name:        "Completions With Usage",
+			path:        "/v1/completions",
+			requestBody: `{"model": "m", "prompt": "Say hi"}`,
+			response:    `{"object":"text_completion","choices":[{"text":"hi"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			wantPath:    "/v1/completions",
+			wantSource:  store.UsageSourceProvider,
+			wantIn:      3,
+			wantOut:     1,
+		},
+		{
+			name:        "Completions Streaming Estimated",
+			path:        "/v1/completions",
+			requestBody: `{"model": "m", "prompt": ["Say", "hello"], "stream": true}`,
+			response:    "data: {\"choices\":[{\"text\":\"Hello\"}]}\n\ndata: {\"choices\":[{\"text\":\" there\"}]}\n\ndata: [DONE]\n\n",
+			wantPath:    "/v1/completions",
+			wantSource:  store.UsageSourceEstimated,
+			wantIn:      est.Count("Say") + est.Count("hello"),
+			wantOut:     est.Count("Hello there"),
+		},
+		{
+			name:        "Responses With Usage",
+			path:        "/v1/responses",
+			requestBody: `{"model": "m", "instructions": "Be brief.", "input": [{"role": "user", "content": [{"type": "input_text", "text": "hi"}]}]}`,
+			response:    `{"object":"response","output":[{"type":"message","content":[{"type":"output_text","text":"Hello"}]}],"usage":{"input_tokens":9,"output_tokens":2,"input_tokens_details":{"cached_tokens":4}}}`,
+			wantPath:    "/v1/responses",
+			wantSource:  store.UsageSourceProvider,
+			wantIn:      9,
+			wantOut:     2,
+			wantCached:  4,
+		},
+		{
+			name:        "Responses Streaming With Completed Usage",
+			path:        "/v1/responses",
+			requestBody: `{"model": "m", "input": "hi", "stream": true}`,
+			response:    "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"Hello\"}\n\nevent: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":7,\"output_tokens\":1}}}\n\n",
+			wantPath:    "/v1/responses",
+			wantSource:  store.UsageSourceProvider,
+			wantIn:      7,
+			wantOut:     1,
+		},
+		{
+			name:        "Responses Streaming Estimated",
+			path:        "/v1/responses",
+			requestBody: `{"model": "m", "input": "hi", "stream": true}`,
+			response:    "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"Hello\"}\n\nevent: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\" world\"}\n\nevent: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"status\":\"completed\"}}\n\n",
+			wantPath:    "/v1/responses",
+			wantSource:  store.UsageSourceEstimated,
+			wantIn:      tokenizer.TokensPerReply + est.Count("hi"),
+			wantOut:     est.Count("Hello world"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamPath string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamPath = r.URL.Path
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, tt.response)
+			}))
+			defer upstream.Close()
+
+			mockUsage := &store.MockUsageStore{}
+			mockModel := &store.MockModelStore{
+				Models: map[string]*store.Model{
+					"m": {ModelID: "m", BaseURLs: []string{upstream.URL + "/v1/chat/completions"}},
+				},
+			}
+			h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 1*time.Second)
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"m"}})
+			})
+			r.POST("/v1/completions", h.CreateTextCompletion)
+			r.POST("/v1/responses", h.CreateResponse)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.requestBody))
+			r.ServeHTTP(w, req)
+			assert.NoError(t, h.Shutdown(context.Background()))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantPath, upstreamPath)
+			assert.Equal(t, tt.response, w.Body.String())
+			if assert.Len(t, mockUsage.Records, 1) {
+				rec := mockUsage.Records[0]
+				assert.Equal(t, tt.wantSource, rec.UsageSource)
+				assert.Equal(t, tt.wantIn, rec.InputTokens)
+				assert.Equal(t, tt.wantOut, rec.OutputTokens)
+				assert.Equal(t, tt.wantCached, rec.CachedTokens)
+			}
+		})
+	}
+}
+
+func TestCompletionsAndResponses_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"m":      {ModelID: "m", BaseURLs: []string{"http://mock-llm.com"}},
+			"claude": {ModelID: "claude", ProviderName: "anthropic", BaseURLs: []string{"http://mock-llm.com"}},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 1*time.Second)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"m", "claude"}})
+	})
+	r.POST("/v1/completions", h.CreateTextCompletion)
+	r.POST("/v1/responses", h.CreateResponse)
+
+	tests := []struct {
+		name           string
+		path           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{"Completions Not Allowed", "/v1/completions", `{"model": "gpt-4", "prompt": "hi"}`, http.StatusForbidden},
+		{"Completions Missing Prompt", "/v1/completions", `{"model": "m"}`, http.StatusBadRequest},
+		{"Completions Prompt Wrong Type", "/v1/completions", `{"model": "m", "prompt": 5}`, http.StatusBadRequest},
+		{"Responses Bad Role", "/v1/responses", `{"model": "m", "input": [{"role": "robot", "content": "hi"}]}`, http.StatusBadRequest},
+		{"Responses Unsupported Provider", "/v1/responses", `{"model": "claude", "input": "hi"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.requestBody))
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
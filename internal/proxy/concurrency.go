@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/user/llm-gateway/internal/middleware"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// defaultSlotLease is how long an in-flight slot is held without being
+// renewed, so the slots of a crashed instance free up within it.
+const defaultSlotLease = 30 * time.Second
+
+// acquireSlot takes one of the tenant's in-flight request slots for a
+// request to model. The slot's lease is renewed until release is called,
+// once the response has been relayed. It replies 429 and returns false when
+// the tenant already has MaxConcurrent requests in flight.
+func (h *Handler) acquireSlot(c *gin.Context, logger *slog.Logger, tenant *store.Tenant, model string) (release func(), ok bool) {
+	if tenant.MaxConcurrent <= 0 {
+		return func() {}, true
+	}
+
+	id := uuid.NewString()
+	taken, err := h.rlStore.AcquireSlot(c.Request.Context(), tenant.TenantID, id, tenant.MaxConcurrent, h.slotLease)
+	if err != nil {
+		// Fail closed, like the rate limits
+		logger.Error("Concurrency check failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limit check failed (concurrency)"})
+		return nil, false
+	}
+	if !taken {
+		logger.Warn("Concurrency limit exceeded", "limit", tenant.MaxConcurrent)
+		middleware.RecordRateLimited(tenant.TenantID, model, "concurrent")
+		// A slot frees up whenever one of the tenant's requests finishes
+		c.Header("Retry-After", "1")
+		code := "concurrency_limit_exceeded"
+		c.JSON(http.StatusTooManyRequests, openai.ErrorResponse{Error: &openai.Error{
+			Message: fmt.Sprintf("Too many concurrent requests (limit: %d). Retry once a request in flight has finished.", tenant.MaxConcurrent),
+			Type:    "rate_limit_error",
+			Code:    &code,
+		}})
+		return nil, false
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(h.slotLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				held, err := h.rlStore.RenewSlot(context.Background(), tenant.TenantID, id, h.slotLease)
+				if err != nil || !held {
+					logger.Warn("Failed to renew concurrency slot", "error", err, "held", held)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		if err := h.rlStore.ReleaseSlot(context.Background(), tenant.TenantID, id); err != nil {
+			logger.Error("Failed to release concurrency slot", "error", err)
+		}
+	}, true
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestCreateCompletion_ConcurrencyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var hits atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("X-Test-Wait") != "" {
+			<-release
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`))
+	}))
+	defer upstream.Close()
+
+	mockModel := &store.MockModelStore{Models: map[string]*store.Model{"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{upstream.URL}}}}
+	rlStore := store.NewMockRateLimitStore()
+	h := NewHandler(rlStore, mockModel, &store.MockUsageStore{}, 5*time.Second)
+	// Short enough that the held request's slot must be renewed
+	h.slotLease = 30 * time.Millisecond
+	tenant := &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}, MaxConcurrent: 1}
+
+	send := func(header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}]}`))
+		for k, v := range header {
+			c.Request.Header[k] = v
+		}
+		c.Set("tenant", tenant)
+		h.CreateCompletion(c)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send(http.Header{"X-Test-Wait": {"1"}}) }()
+	require.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	w := send(nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	var resp openai.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.NotNil(t, resp.Error) && assert.NotNil(t, resp.Error.Code) {
+		assert.Equal(t, "concurrency_limit_exceeded", *resp.Error.Code)
+	}
+	assert.Equal(t, int32(1), hits.Load(), "Rejected before reaching the upstream")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+
+	w = send(nil)
+	assert.Equal(t, http.StatusOK, w.Code, "The slot is released once the response is relayed")
+	require.NoError(t, h.Shutdown(context.Background()))
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/provider"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// CreateEmbedding proxies /v1/embeddings through the same allow-list,
+// routing, failover and metering as chat completions. Embeddings only have
+// input tokens.
+func (h *Handler) CreateEmbedding(c *gin.Context) {
+	start := time.Now()
+	tenant, ok := tenantFromContext(c)
+	if !ok {
+		return
+	}
+
+	bodyBytes, ok := readBody(c, tenant)
+	if !ok {
+		return
+	}
+
+	embReq, apiErr := openai.DecodeEmbeddingRequest(bodyBytes)
+	if apiErr != nil {
+		slog.Warn("Invalid JSON body", "error", apiErr, "tenant_id", tenant.TenantID)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	logger := slog.With("tenant_id", tenant.TenantID, "model", embReq.Model)
+
+	if !modelAllowed(tenant, embReq.Model) {
+		logger.Warn("Model not allowed for this tenant")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this tenant"})
+		return
+	}
+
+	if apiErr := embReq.Validate(); apiErr != nil {
+		logger.Warn("Invalid embedding request", "error", apiErr)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	requested, adapter, ok := h.resolveModel(c, logger, embReq.Model, provider.Embeddings)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquireSlot(c, logger, tenant, embReq.Model)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Embeddings generate no tokens; only the input is reserved
+	inputTokens := countEmbeddingTokens(h.tokenizers.Get(requested.Tokenizer), embReq)
+	if !h.reserveTokens(c, logger, tenant, embReq.Model, inputTokens) {
+		return
+	}
+
+	modelConfig, _, resp, ok := h.dispatch(c, logger, tenant, requested, adapter, provider.Embeddings, bodyBytes, false)
+	if !ok {
+		h.refundTokens(tenant, embReq.Model, inputTokens)
+		return
+	}
+	defer resp.Body.Close()
+
+	latency := time.Since(start)
+	logger.Info("Proxy request completed", "status", resp.StatusCode, "latency_ms", latency.Milliseconds())
+
+	copyResponseHeaders(c, resp)
+	body, _ := ioutil.ReadAll(resp.Body)
+	c.Writer.Write(body)
+
+	// Provider-reported usage is authoritative; estimates are the fallback
+	estimate := inputTokens
+	if modelConfig.Tokenizer != requested.Tokenizer {
+		estimate = countEmbeddingTokens(h.tokenizers.Get(modelConfig.Tokenizer), embReq)
+	}
+	var reported *openAIUsage
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		reported = parseEmbeddingUsage(body)
+	}
+	usage := resolveUsage(reported, estimate, 0)
+	if usage.Source == store.UsageSourceEstimated {
+		logger.Debug("Upstream did not report usage, using estimate")
+	}
+
+	h.recordUsage(c, tenant, inputTokens, embReq.Model, modelConfig.ModelID, start, usage)
+}
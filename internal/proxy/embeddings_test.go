@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-gateway/internal/store"
+	"github.com/user/llm-gateway/internal/tokenizer"
+)
+
+func TestCreateEmbedding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		allowedModels  []string
+		response       string
+		expectedStatus int
+		wantSource     string
+		wantIn         int
+	}{
+		{
+			name:           "String Input With Provider Usage",
+			requestBody:    `{"model": "embed", "input": "hello world"}`,
+			allowedModels:  []string{"embed"},
+			response:       `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":2,"total_tokens":2}}`,
+			expectedStatus: http.StatusOK,
+			wantSource:     store.UsageSourceProvider,
+			wantIn:         2,
+		},
+		{
+			name:           "Array Input Estimated",
+			requestBody:    `{"model": "embed", "input": ["hello", "big world"]}`,
+			allowedModels:  []string{"*"},
+			response:       `{"object":"list","data":[]}`,
+			expectedStatus: http.StatusOK,
+			wantSource:     store.UsageSourceEstimated,
+			wantIn:         tokenizer.Estimator{}.Count("hello") + tokenizer.Estimator{}.Count("big world"),
+		},
+		{
+			name:           "Token Array Input Estimated",
+			requestBody:    `{"model": "embed", "input": [[1, 2, 3], [4]]}`,
+			allowedModels:  []string{"*"},
+			response:       `{"object":"list","data":[]}`,
+			expectedStatus: http.StatusOK,
+			wantSource:     store.UsageSourceEstimated,
+			wantIn:         4,
+		},
+		{
+			name:           "Model Not Allowed",
+			requestBody:    `{"model": "embed", "input": "hi"}`,
+			allowedModels:  []string{"gpt-4"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Missing Input",
+			requestBody:    `{"model": "embed"}`,
+			allowedModels:  []string{"*"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Provider Without Embeddings",
+			requestBody:    `{"model": "claude", "input": "hi"}`,
+			allowedModels:  []string{"*"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamPath string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamPath = r.URL.Path
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, tt.response)
+			}))
+			defer upstream.Close()
+
+			mockUsage := &store.MockUsageStore{}
+			mockModel := &store.MockModelStore{
+				Models: map[string]*store.Model{
+					"embed":  {ModelID: "embed", BaseURLs: []string{upstream.URL + "/v1/chat/completions"}},
+					"claude": {ModelID: "claude", ProviderName: "anthropic", BaseURLs: []string{upstream.URL}},
+				},
+			}
+			h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 1*time.Second)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(tt.requestBody))
+			c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: tt.allowedModels})
+
+			h.CreateEmbedding(c)
+			assert.NoError(t, h.Shutdown(context.Background()))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.Empty(t, mockUsage.Records)
+				return
+			}
+
+			assert.Equal(t, "/v1/embeddings", upstreamPath)
+			assert.Equal(t, tt.response, w.Body.String())
+			if assert.Len(t, mockUsage.Records, 1) {
+				rec := mockUsage.Records[0]
+				assert.Equal(t, tt.wantSource, rec.UsageSource)
+				assert.Equal(t, tt.wantIn, rec.InputTokens)
+				assert.Zero(t, rec.OutputTokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/provider"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// servedModelHeader tells the client which model answered, which differs
+// from the requested one when a fallback served the request.
+const servedModelHeader = "X-LLM-Served-Model"
+
+// dispatch forwards body to the resolved model. When every upstream of the
+// model fails, the model's fallbacks are tried in order, skipping those the
+// tenant may not use or that cannot serve api, with the body's "model"
+// rewritten for each. It replies with an error and returns false when no
+// model could serve the request; otherwise it returns the model that did,
+// its adapter and the response the caller owns.
+func (h *Handler) dispatch(c *gin.Context, logger *slog.Logger, tenant *store.Tenant, modelConfig *store.Model, adapter provider.Adapter, api provider.API, body []byte, stream bool) (*store.Model, provider.Adapter, *http.Response, bool) {
+	resp, perr := h.forward(c, logger, tenant, modelConfig, adapter, body, stream)
+	for _, fallback := range fallbackChain(modelConfig) {
+		if perr == nil || c.Request.Context().Err() != nil {
+			break
+		}
+		if !modelAllowed(tenant, fallback) {
+			logger.Info("Skipping fallback model not allowed for tenant", "fallback", fallback)
+			continue
+		}
+		fbConfig, fbAdapter, lookupErr := h.lookupModel(c.Request.Context(), logger, fallback, api)
+		if lookupErr != nil {
+			logger.Warn("Skipping unavailable fallback model", "fallback", fallback, "error", lookupErr)
+			continue
+		}
+		fbBody, err := withModel(body, fallback)
+		if err != nil {
+			logger.Error("Failed to rewrite model for fallback", "fallback", fallback, "error", err)
+			continue
+		}
+
+		logger.Warn("Model failed, falling back", "fallback", fallback, "error", perr)
+		modelConfig, adapter = fbConfig, fbAdapter
+		resp, perr = h.forward(c, logger.With("served_model", fallback), tenant, fbConfig, fbAdapter, fbBody, stream)
+	}
+	if perr != nil {
+		perr.reply(c, logger)
+		return nil, nil, nil, false
+	}
+
+	c.Header(servedModelHeader, modelConfig.ModelID)
+	return modelConfig, adapter, resp, true
+}
+
+// fallbackChain returns the model's fallbacks without duplicates or the
+// model itself.
+func fallbackChain(m *store.Model) []string {
+	seen := map[string]bool{m.ModelID: true}
+	chain := make([]string, 0, len(m.Fallbacks))
+	for _, id := range m.Fallbacks {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		chain = append(chain, id)
+	}
+	return chain
+}
+
+// withModel returns body with its "model" field set to model, leaving the
+// other fields as sent.
+func withModel(body []byte, model string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	name, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	fields["model"] = name
+
+	// Don't escape <, > and & inside the client's values
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(fields); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
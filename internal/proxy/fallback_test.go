@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestCreateCompletion_ModelFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	var servedBody map[string]any
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &servedBody)
+		w.Write([]byte(`{"choices":[{"message":{"content":"Hello"}}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`))
+	}))
+	defer up.Close()
+
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4o":        {ModelID: "gpt-4o", BaseURLs: []string{down.URL}, Fallbacks: []string{"gpt-4o", "restricted", "missing", "claude-sonnet"}},
+			"restricted":    {ModelID: "restricted", BaseURLs: []string{up.URL}},
+			"claude-sonnet": {ModelID: "claude-sonnet", BaseURLs: []string{up.URL}},
+		},
+	}
+
+	send := func(allowed []string) (*httptest.ResponseRecorder, *store.MockUsageStore) {
+		mockUsage := &store.MockUsageStore{}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4o", "temperature": 0.5, "messages": [{"role": "user", "content": "<hi>"}]}`))
+		c.Request.Header.Set("X-LLM-Retry-Max", "0")
+		c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: allowed})
+		h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 1*time.Second)
+		h.CreateCompletion(c)
+		require.NoError(t, h.Shutdown(context.Background()))
+		return w, mockUsage
+	}
+
+	t.Run("Serves From Allowed Fallback", func(t *testing.T) {
+		// "restricted" is not allowed and "missing" is not configured
+		w, mockUsage := send([]string{"gpt-4o", "missing", "claude-sonnet"})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "claude-sonnet", w.Header().Get(servedModelHeader))
+		assert.Equal(t, "claude-sonnet", servedBody["model"], "Forwarded body names the fallback")
+		assert.Equal(t, 0.5, servedBody["temperature"])
+		if assert.Len(t, mockUsage.Records, 1) {
+			assert.Equal(t, "gpt-4o", mockUsage.Records[0].ModelID)
+			assert.Equal(t, "claude-sonnet", mockUsage.Records[0].ServedModelID)
+			assert.Equal(t, 5, mockUsage.Records[0].InputTokens)
+		}
+	})
+
+	t.Run("No Allowed Fallback", func(t *testing.T) {
+		w, mockUsage := send([]string{"gpt-4o"})
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.Empty(t, w.Header().Get(servedModelHeader))
+		assert.Empty(t, mockUsage.Records)
+	})
+
+	t.Run("Primary Serves", func(t *testing.T) {
+		mockModel.Models["gpt-4o"].BaseURLs = []string{up.URL}
+		defer func() { mockModel.Models["gpt-4o"].BaseURLs = []string{down.URL} }()
+
+		w, _ := send([]string{"*"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gpt-4o", w.Header().Get(servedModelHeader))
+	})
+}
+
+func TestWithModel(t *testing.T) {
+	body, err := withModel([]byte(`{"model":"gpt-4o","stop":["<end>"],"n":2}`), "claude-sonnet")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"claude-sonnet","stop":["<end>"],"n":2}`, string(body))
+	assert.Contains(t, string(body), `"<end>"`, "Values are not HTML-escaped")
+
+	_, err = withModel([]byte(`[]`), "claude-sonnet")
+	assert.Error(t, err)
+}
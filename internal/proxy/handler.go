@@ -1,74 +1,108 @@
 package proxy
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log/slog"
-	"math"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sony/gobreaker"
 	"github.com/user/llm-gateway/internal/middleware"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/provider"
+	"github.com/user/llm-gateway/internal/sse"
 	"github.com/user/llm-gateway/internal/store"
+	"github.com/user/llm-gateway/internal/tokenizer"
 )
 
-type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
-}
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
 type Handler struct {
 	rlStore    store.RateLimitStore
 	modelStore store.ModelStore
 	usageStore store.UsageStore
 	httpClient *http.Client
-	cb         *gobreaker.CircuitBreaker
-	wg         sync.WaitGroup
+	breakers   *breakerRegistry
+	balancers  *balancerRegistry
+	health     EndpointHealth
+	tokenizers *tokenizer.Registry
+	// timeout bounds non-streaming attempts of models that set no total
+	// timeout
+	timeout time.Duration
+	// streamIdleTimeout fails streams that send nothing for this long,
+	// unless the model sets its own
+	streamIdleTimeout time.Duration
+	// slotLease is how long a tenant's in-flight slot outlives its last
+	// renewal
+	slotLease time.Duration
+	awsConfig *aws.Config
+	wg        sync.WaitGroup
 }
 
-func NewHandler(rlStore store.RateLimitStore, modelStore store.ModelStore, usageStore store.UsageStore, timeout time.Duration) *Handler {
-	st := gobreaker.Settings{
-		Name:        "LLM-Proxy-CB",
-		MaxRequests: 5,
-		Interval:    60 * time.Second,
-		Timeout:     30 * time.Second,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-			return counts.Requests >= 10 && failureRatio >= 0.6
-		},
+// EndpointHealth reports whether a model's base URL passes its health checks.
+type EndpointHealth interface {
+	Healthy(modelID, baseURL string) bool
+}
+
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithAWSConfig sets the AWS configuration used to sign Bedrock requests.
+func WithAWSConfig(cfg aws.Config) Option {
+	return func(h *Handler) {
+		h.awsConfig = &cfg
+	}
+}
+
+// WithHealthChecker removes endpoints that fail their health checks from
+// upstream selection.
+func WithHealthChecker(health EndpointHealth) Option {
+	return func(h *Handler) {
+		h.health = health
+	}
+}
+
+// WithTokenizers sets the registry used to count prompt and completion tokens.
+func WithTokenizers(r *tokenizer.Registry) Option {
+	return func(h *Handler) {
+		h.tokenizers = r
 	}
+}
 
-	return &Handler{
+func NewHandler(rlStore store.RateLimitStore, modelStore store.ModelStore, usageStore store.UsageStore, timeout time.Duration, opts ...Option) *Handler {
+	h := &Handler{
 		rlStore:    rlStore,
 		modelStore: modelStore,
 		usageStore: usageStore,
+		// Attempts are bounded per model (see timeoutsFor), not per client
 		httpClient: &http.Client{
-			Timeout: timeout,
 			Transport: &http.Transport{
 				MaxIdleConns:        100,
 				MaxIdleConnsPerHost: 100,
 				IdleConnTimeout:     90 * time.Second,
 			},
 		},
-		cb: gobreaker.NewCircuitBreaker(st),
+		breakers:          newBreakerRegistry(),
+		balancers:         newBalancerRegistry(),
+		tokenizers:        tokenizer.NewRegistry(""),
+		timeout:           timeout,
+		streamIdleTimeout: defaultStreamIdleTimeout,
+		slotLease:         defaultSlotLease,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Shutdown waits for all async tasks to complete
@@ -90,35 +124,22 @@ func (h *Handler) Shutdown(ctx context.Context) error {
 
 func (h *Handler) CreateCompletion(c *gin.Context) {
 	start := time.Now()
-	tenantCtx, exists := c.Get("tenant")
-	if !exists {
-		slog.Error("Tenant context missing", "path", c.Request.URL.Path)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Tenant context missing"})
+	tenant, ok := tenantFromContext(c)
+	if !ok {
 		return
 	}
-	tenant := tenantCtx.(*store.Tenant)
 
 	// 1. Read and buffer body to inspect model
-	// Hard Limit: 10MB to prevent OOM
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 10*1024*1024)
-	bodyBytes, err := ioutil.ReadAll(c.Request.Body)
-	if err != nil {
-		if err.Error() == "http: request body too large" {
-			slog.Warn("Request body too large", "tenant_id", tenant.TenantID)
-			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large (limit: 10MB)"})
-			return
-		}
-		slog.Error("Failed to read body", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+	bodyBytes, ok := readBody(c, tenant)
+	if !ok {
 		return
 	}
-	// Restore body for upstream
-	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
-	var chatReq ChatRequest
-	if err := json.Unmarshal(bodyBytes, &chatReq); err != nil {
-		slog.Warn("Invalid JSON body", "error", err, "tenant_id", tenant.TenantID)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+	// The typed request is only inspected; the original bytes are forwarded
+	chatReq, apiErr := openai.DecodeChatRequest(bodyBytes)
+	if apiErr != nil {
+		slog.Warn("Invalid JSON body", "error", apiErr, "tenant_id", tenant.TenantID)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
 		return
 	}
 
@@ -132,196 +153,495 @@ func (h *Handler) CreateCompletion(c *gin.Context) {
 	logger := slog.With("tenant_id", tenant.TenantID, "model", chatReq.Model)
 
 	// 2. Validate Model access
-	allowed := false
-	for _, m := range tenant.AllowedModels {
-		if m == "*" || m == chatReq.Model {
-			allowed = true
-			break
-		}
-	}
-	if !allowed {
+	if !modelAllowed(tenant, chatReq.Model) {
 		logger.Warn("Model not allowed for this tenant")
 		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this tenant"})
 		return
 	}
 
-	// 3. Lookup Model Config
-	modelConfig, err := h.modelStore.GetModel(c.Request.Context(), chatReq.Model)
-	if err != nil {
-		logger.Error("Failed to resolve model config", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve model config"})
+	// Validate parameter ranges and shapes
+	if apiErr := chatReq.Validate(); apiErr != nil {
+		logger.Warn("Invalid chat request", "error", apiErr)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
 		return
 	}
-	if modelConfig == nil {
-		logger.Warn("Model configuration not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Model configuration not found"})
+
+	// 3. Lookup Model Config and Provider
+	requested, adapter, ok := h.resolveModel(c, logger, chatReq.Model, provider.ChatCompletions)
+	if !ok {
 		return
 	}
 
-	// 4. Determine Upstream Candidates
-	baseURLs := modelConfig.BaseURLs
-	if len(baseURLs) == 0 {
-		logger.Error("No base URLs configured for model")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Misconfigured model: no base URLs"})
+	// Hold one of the tenant's in-flight slots until the response is relayed
+	release, ok := h.acquireSlot(c, logger, tenant, chatReq.Model)
+	if !ok {
 		return
 	}
-	apiKey := os.Getenv(modelConfig.APIKeyEnv)
-	if apiKey == "" {
-		logger.Warn("API Key env var not set for model", "env_var", modelConfig.APIKeyEnv)
+	defer release()
+
+	// Count Input Tokens with the model's encoding and reserve them, with
+	// the maximum completion of every choice, against the tenant's TPM
+	tok := h.tokenizers.Get(requested.Tokenizer)
+	inputTokens := countPromptTokens(tok, chatReq)
+	reserved := inputTokens + outputReservation(chatReq.MaxOutputTokens(), chatReq.N)
+	if !h.reserveTokens(c, logger, tenant, chatReq.Model, reserved) {
+		return
+	}
+
+	// 4. Execute Request with Retry, Failover & Model Fallbacks
+	modelConfig, adapter, resp, ok := h.dispatch(c, logger, tenant, requested, adapter, provider.ChatCompletions, bodyBytes, chatReq.Stream)
+	if !ok {
+		h.refundTokens(tenant, chatReq.Model, reserved)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Log Latency
+	latency := time.Since(start)
+	logger.Info("Proxy request completed", "status", resp.StatusCode, "latency_ms", latency.Milliseconds())
+
+	// 5. Forward Response Headers
+	copyResponseHeaders(c, resp)
+
+	// A fallback may use another encoding
+	if modelConfig.Tokenizer != requested.Tokenizer {
+		tok = h.tokenizers.Get(modelConfig.Tokenizer)
+		inputTokens = countPromptTokens(tok, chatReq)
 	}
 
-	// Retry Policy Config (Headers > Defaults)
-	retryMax := 3
-	backoffMs := 100
-	retryFactor := 2.0
+	// 6. Handle Response Body (Streaming vs Non-Streaming)
+	usage := h.relayResponse(c, logger, resp, adapter, chatReq.Stream, tenant.TenantID, modelConfig, start, tok, inputTokens, chatFormat)
 
-	// Helper to parse header int
-	if hVal := c.GetHeader("X-LLM-Retry-Max"); hVal != "" {
-		if val, err := strconv.Atoi(hVal); err == nil && val >= 0 && val <= 10 {
-			retryMax = val
+	// 7. Update Metrics & Logs
+	h.recordUsage(c, tenant, reserved, chatReq.Model, modelConfig.ModelID, start, usage)
+}
+
+// relayResponse writes the upstream body to the client, translated by the
+// adapter, and returns the request's usage: provider-reported when the
+// upstream sent it, otherwise estimated from inputTokens and the generated
+// text.
+func (h *Handler) relayResponse(c *gin.Context, logger *slog.Logger, resp *http.Response, adapter provider.Adapter, stream bool, tenantID string, modelConfig *store.Model, start time.Time, tok tokenizer.Tokenizer, inputTokens int, format responseFormat) Usage {
+	var outputTokens int
+	var reported *openAIUsage
+
+	// Error bodies are forwarded untranslated
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+
+	var partial bool
+	if stream && success {
+		// Streaming Response (converted to OpenAI chunks by the adapter)
+		body := adapter.TranslateStream(resp.Body)
+		defer body.Close()
+
+		// A stalled stream is aborted by closing it, upstream first
+		watched := newIdleReader(body, h.timeoutsFor(modelConfig, true).idle, func() {
+			resp.Body.Close()
+			body.Close()
+		})
+		defer watched.stop()
+
+		var interrupted *streamInterruption
+		outputTokens, reported, interrupted = h.streamResponse(c, watched, tenantID, modelConfig.ModelID, start, tok, format)
+		if interrupted != nil {
+			partial = true
+			logger.Warn("Upstream stream interrupted", "reason", interrupted.reason, "error", interrupted.err, "output_tokens", outputTokens)
+			middleware.RecordStreamInterruption(modelConfig.ModelID, interrupted.reason)
+			if te, ok := asTimeout(interrupted.err); ok {
+				middleware.RecordUpstreamTimeout(modelConfig.ModelID, te.phase)
+			}
+			if interrupted.reason != interruptClient {
+				c.Writer.WriteString(format.streamError("stream_interrupted", fmt.Sprintf("The upstream stream ended unexpectedly (%s).", interrupted.reason)))
+				c.Writer.Flush()
+			}
+		}
+	} else {
+		// Non-Streaming Response
+		body, _ := ioutil.ReadAll(resp.Body)
+		if success {
+			translated, err := adapter.TranslateResponse(body)
+			if err != nil {
+				logger.Error("Failed to translate upstream response", "error", err)
+				c.Status(http.StatusBadGateway)
+				translated, _ = json.Marshal(gin.H{"error": "Invalid upstream response"})
+				success = false
+			}
+			body = translated
+		}
+		c.Writer.Write(body)
+		// Error bodies are not generated output
+		if success {
+			outputTokens, reported = format.parseBody(tok, body)
+		}
+	}
+
+	// Provider-reported usage is authoritative; estimates are the fallback
+	usage := resolveUsage(reported, inputTokens, outputTokens)
+	usage.Partial = partial
+	if usage.Source == store.UsageSourceEstimated {
+		logger.Debug("Upstream did not report usage, using estimate")
+	}
+	return usage
+}
+
+// tenantFromContext returns the tenant set by the auth middleware, replying
+// with an error when it is missing.
+func tenantFromContext(c *gin.Context) (*store.Tenant, bool) {
+	tenantCtx, exists := c.Get("tenant")
+	if !exists {
+		slog.Error("Tenant context missing", "path", c.Request.URL.Path)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Tenant context missing"})
+		return nil, false
+	}
+	return tenantCtx.(*store.Tenant), true
+}
+
+// readBody buffers the request body so it can be inspected and forwarded,
+// replying with an error when it cannot be read.
+func readBody(c *gin.Context, tenant *store.Tenant) ([]byte, bool) {
+	// Hard Limit: 10MB to prevent OOM
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, middleware.MaxBodyBytes)
+	bodyBytes, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			slog.Warn("Request body too large", "tenant_id", tenant.TenantID)
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large (limit: 10MB)"})
+			return nil, false
 		}
+		slog.Error("Failed to read body", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return nil, false
 	}
-	if hVal := c.GetHeader("X-LLM-Retry-Backoff-Ms"); hVal != "" {
-		if val, err := strconv.Atoi(hVal); err == nil && val >= 0 {
-			backoffMs = val
+	// Restore body for upstream
+	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	return bodyBytes, true
+}
+
+// modelAllowed reports whether the tenant's allow-list includes model.
+func modelAllowed(tenant *store.Tenant, model string) bool {
+	for _, m := range tenant.AllowedModels {
+		if m == "*" || m == model {
+			return true
 		}
 	}
+	return false
+}
+
+// proxyError is a failure to serve a request, with the reply sent to the
+// client when nothing else can serve it.
+type proxyError struct {
+	status int
+	body   any
+	msg    string
+	args   []any
+}
+
+func (e *proxyError) Error() string {
+	return e.msg
+}
+
+// reply logs the failure and sends the error response.
+func (e *proxyError) reply(c *gin.Context, logger *slog.Logger) {
+	if e.status >= 500 {
+		logger.Error(e.msg, e.args...)
+	} else {
+		logger.Warn(e.msg, e.args...)
+	}
+	c.JSON(e.status, e.body)
+}
+
+// resolveModel looks up the model config and the provider adapter serving
+// api for it, replying with an error when either is unavailable.
+func (h *Handler) resolveModel(c *gin.Context, logger *slog.Logger, model string, api provider.API) (*store.Model, provider.Adapter, bool) {
+	modelConfig, adapter, perr := h.lookupModel(c.Request.Context(), logger, model, api)
+	if perr != nil {
+		perr.reply(c, logger)
+		return nil, nil, false
+	}
+	return modelConfig, adapter, true
+}
+
+// lookupModel is resolveModel without the reply.
+func (h *Handler) lookupModel(ctx context.Context, logger *slog.Logger, model string, api provider.API) (*store.Model, provider.Adapter, *proxyError) {
+	modelConfig, err := h.modelStore.GetModel(ctx, model)
+	if err != nil {
+		return nil, nil, &proxyError{http.StatusInternalServerError, gin.H{"error": "Failed to resolve model config"}, "Failed to resolve model config", []any{"error", err}}
+	}
+	if modelConfig == nil {
+		return nil, nil, &proxyError{http.StatusNotFound, gin.H{"error": "Model configuration not found"}, "Model configuration not found", nil}
+	}
+
+	if len(modelConfig.BaseURLs) == 0 {
+		return nil, nil, &proxyError{http.StatusInternalServerError, gin.H{"error": "Misconfigured model: no base URLs"}, "No base URLs configured for model", nil}
+	}
+	apiKey := os.Getenv(modelConfig.APIKeyEnv)
+	if apiKey == "" && !strings.EqualFold(modelConfig.ProviderName, provider.Bedrock) {
+		logger.Warn("API Key env var not set for model", "env_var", modelConfig.APIKeyEnv)
+	}
+	adapter, err := provider.New(modelConfig, api, provider.Credentials{APIKey: apiKey, AWS: h.awsConfig})
+	if errors.Is(err, provider.ErrUnsupportedAPI) {
+		return nil, nil, &proxyError{http.StatusBadRequest, openai.ErrorResponse{Error: openai.InvalidRequest("model", "model_not_supported", "The model '%s' does not support %s.", model, api)}, "Model does not support API", []any{"api", api}}
+	}
+	if err != nil {
+		return nil, nil, &proxyError{http.StatusInternalServerError, gin.H{"error": "Misconfigured model: " + err.Error()}, "Failed to resolve provider adapter", []any{"error", err}}
+	}
+	return modelConfig, adapter, nil
+}
+
+// forward sends body upstream with retry and failover across the model's
+// base URLs, in the order chosen by the model's load balancer. It returns an
+// error when every attempt failed; otherwise the caller owns the response.
+func (h *Handler) forward(c *gin.Context, logger *slog.Logger, tenant *store.Tenant, modelConfig *store.Model, adapter provider.Adapter, bodyBytes []byte, stream bool) (*http.Response, *proxyError) {
+	lb := h.balancers.get(modelConfig)
+	baseURLs := h.healthyEndpoints(logger, modelConfig.ModelID, lb.Order())
+	ctx := c.Request.Context()
+
+	// Retry Policy Config (tenant and model policies, tightened by headers)
+	policy := newRetryPolicy(tenant, modelConfig, c.Request.Header)
+	deadline := time.Now().Add(policy.budget)
 
-	// 5. Execute Request with Retry & Failover
 	// Using shared client for connection pooling
 	var resp *http.Response
 	var lastErr error
 
-	attempt := 0
+	header := c.Request.Header.Clone()
+	header.Del("Host")
+	// Remove retry headers from upstream request
+	header.Del("X-LLM-Retry-Max")
+	header.Del("X-LLM-Retry-Backoff-Ms")
+
+	// Use c.Request.Context() to propagate client cancellation
+	limits := h.timeoutsFor(modelConfig, stream)
+	send := func(url string, done func(bool)) sendFunc {
+		return func(callCtx context.Context, cancel context.CancelFunc) *upstreamCall {
+			return h.call(callCtx, cancel, lb, adapter, url, bodyBytes, header, limits, done)
+		}
+	}
+	// success condition
+	accept := func(u *upstreamCall) bool {
+		return u.err == nil && u.resp.StatusCode < 500 && !policy.retryStatus(u.resp.StatusCode)
+	}
+
+	// When each upstream asked not to be retried before (Retry-After)
+	retryAt := make(map[string]time.Time)
 	urlIndex := 0
 
-	for attempt <= retryMax {
-		// Round-robin selection of URL based on attempt count (Failover strategy)
-		currentURL := baseURLs[urlIndex%len(baseURLs)]
+	for attempt := 0; attempt <= policy.maxRetries; attempt++ {
+		// Walk the balanced candidates based on attempt count (Failover strategy),
+		// skipping endpoints whose circuit breaker rejects requests
+		var currentURL string
+		var done func(success bool)
+		for skipped := 0; skipped < len(baseURLs); skipped++ {
+			currentURL = baseURLs[urlIndex%len(baseURLs)]
+			allow, err := h.breakers.get(modelConfig, currentURL).Allow()
+			if err == nil {
+				done = allow
+				break
+			}
+			logger.Warn("Circuit breaker open, skipping upstream", "url", currentURL, "error", err)
+			urlIndex++
+		}
+		if done == nil {
+			if resp != nil {
+				drainAndClose(resp)
+				resp = nil
+			}
+			lastErr = gobreaker.ErrOpenState
+			break
+		}
 
-		logger.Info("Attempting upstream", "attempt", attempt, "url", currentURL, "stream", chatReq.Stream)
+		// The previous attempt's response is only kept in case no retry
+		// happens; release its connection now
+		if resp != nil {
+			drainAndClose(resp)
+			resp = nil
+		}
 
-		// Use c.Request.Context() to propagate client cancellation
-		proxyReq, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, currentURL, bytes.NewBuffer(bodyBytes))
-		if err != nil {
-			logger.Error("Failed to create upstream request", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upstream request"})
-			return
-		}
-		proxyReq.Header = c.Request.Header.Clone()
-		proxyReq.Header.Set("Authorization", "Bearer "+apiKey)
-		proxyReq.Header.Del("Host")
-		// Remove retry headers from upstream request
-		proxyReq.Header.Del("X-LLM-Retry-Max")
-		proxyReq.Header.Del("X-LLM-Retry-Backoff-Ms")
-
-		// Execute with Circuit Breaker
-		respInterface, cbErr := h.cb.Execute(func() (interface{}, error) {
-			return h.httpClient.Do(proxyReq)
-		})
+		logger.Info("Attempting upstream", "attempt", attempt, "url", currentURL, "stream", stream)
 
-		if cbErr != nil {
-			lastErr = cbErr
-			if cbErr == gobreaker.ErrOpenState {
-				logger.Warn("Circuit breaker open")
-				break
-			}
+		// Latency-sensitive tenants hedge slow attempts to another endpoint
+		var call *upstreamCall
+		if delay, ok := hedgeDelay(tenant, lb, stream); ok {
+			call = hedged(ctx, modelConfig.ModelID, delay, send(currentURL, done), func() (sendFunc, bool) {
+				return h.hedgeTarget(logger, modelConfig, baseURLs, urlIndex, currentURL, send)
+			}, accept)
 		} else {
-			resp = respInterface.(*http.Response)
-			lastErr = nil // Clear error if success
+			callCtx, cancel := context.WithCancel(ctx)
+			call = send(currentURL, done)(callCtx, cancel)
 		}
 
-		// success condition
-		if lastErr == nil && resp.StatusCode < 500 && resp.StatusCode != 429 {
+		var buildErr *buildError
+		if errors.As(call.err, &buildErr) {
+			// The provider cannot express the request; the client has to change it
+			var apiErr *openai.Error
+			if errors.As(buildErr.err, &apiErr) {
+				return nil, &proxyError{http.StatusBadRequest, openai.ErrorResponse{Error: apiErr}, "Request not supported by provider", []any{"error", apiErr}}
+			}
+			return nil, &proxyError{http.StatusInternalServerError, gin.H{"error": "Failed to create upstream request"}, "Failed to create upstream request", []any{"error", buildErr.err}}
+		}
+		lastErr, resp = call.err, call.resp
+
+		accepted := accept(call)
+		// Only a successful stream carries events; other accepted statuses
+		// are relayed as they are, however short their body
+		if accepted && stream && resp.StatusCode/100 == 2 {
+			if err := primeStream(resp, limits.idle); err != nil {
+				logger.Warn("Upstream stream failed before sending data", "url", call.url, "error", err)
+				resp.Body.Close()
+				lastErr, resp, accepted = err, nil, false
+			}
+		}
+		if te, ok := asTimeout(lastErr); ok {
+			middleware.RecordUpstreamTimeout(modelConfig.ModelID, te.phase)
+		}
+		if accepted {
+			// Response headers mark the first byte, or the whole generation
+			// when not streamed; the request stays in flight until the
+			// caller closes the body
+			lb.Observe(call.url, call.ttfb, stream)
+			resp.Body = &trackedBody{ReadCloser: resp.Body, done: call.finish}
 			break
 		}
+		call.finish()
 
-		// Failure handling
-		attempt++
-
-		// Failover on Network Error, 5xx, or 429
-		shouldFailover := lastErr != nil || resp.StatusCode >= 500 || resp.StatusCode == 429
-		if shouldFailover {
-			urlIndex++ // Switch to next provider/url
+		// A client that went away gets no more attempts
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			break
+		}
+		if attempt == policy.maxRetries || !policy.retries(resp, lastErr) {
+			break
 		}
 
-		if attempt <= retryMax {
-			// Skip backoff for 429 Failover (Fail fast to backup)
-			if resp != nil && resp.StatusCode == 429 && shouldFailover {
-				logger.Info("Rate limited (429), failing over immediately", "url", currentURL)
-				continue
+		if resp != nil {
+			if wait, ok := retryAfter(resp.Header, time.Now()); ok {
+				retryAt[currentURL] = time.Now().Add(wait)
 			}
+		}
+
+		// Failover on retryable errors to the next provider/url
+		urlIndex++
+		nextURL := baseURLs[urlIndex%len(baseURLs)]
 
-			sleepTime := time.Duration(backoffMs) * time.Millisecond * time.Duration(math.Pow(retryFactor, float64(attempt-1)))
-			time.Sleep(sleepTime)
+		// Skip backoff for 429 Failover (Fail fast to backup), but never
+		// retry an upstream before the time it asked for
+		var wait time.Duration
+		if resp != nil && resp.StatusCode == 429 && nextURL != currentURL {
+			logger.Info("Rate limited (429), failing over immediately", "url", currentURL)
+		} else {
+			wait = policy.backoff(attempt + 1)
+		}
+		if until, ok := retryAt[nextURL]; ok {
+			wait = max(wait, time.Until(until))
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			logger.Warn("Retry budget exhausted", "budget", policy.budget, "wait", wait)
+			break
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			lastErr = err
+			break
 		}
 	}
 
+	if lastErr != nil && ctx.Err() != nil {
+		if resp != nil {
+			drainAndClose(resp)
+		}
+		return nil, &proxyError{statusClientClosedRequest, gin.H{"error": "Client closed request"}, "Client canceled request during upstream retries", []any{"error", lastErr}}
+	}
+	if lastErr == gobreaker.ErrOpenState {
+		return nil, &proxyError{http.StatusServiceUnavailable, gin.H{"error": "Upstream provider unavailable", "details": "circuit breaker open for every upstream"}, "No upstream available, all circuit breakers open", nil}
+	}
+	if te, ok := asTimeout(lastErr); ok {
+		return nil, &proxyError{http.StatusGatewayTimeout, openai.ErrorResponse{Error: upstreamTimeout(te)}, "Upstream provider timed out after retries", []any{"error", te}}
+	}
 	if lastErr != nil {
-		logger.Error("Upstream provider failed after retries", "error", lastErr)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Upstream provider failed", "details": lastErr.Error()})
-		return
+		return nil, &proxyError{http.StatusBadGateway, gin.H{"error": "Upstream provider failed", "details": lastErr.Error()}, "Upstream provider failed after retries", []any{"error", lastErr}}
 	}
 	if resp != nil && resp.StatusCode >= 500 {
-		logger.Error("Upstream provider returned 5xx after retries", "status", resp.StatusCode)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Upstream provider error", "status": resp.StatusCode})
-		return
+		drainAndClose(resp)
+		return nil, &proxyError{http.StatusBadGateway, gin.H{"error": "Upstream provider error", "status": resp.StatusCode}, "Upstream provider returned 5xx after retries", []any{"status", resp.StatusCode}}
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
-	// Log Latency
-	latency := time.Since(start)
-	logger.Info("Proxy request completed", "status", resp.StatusCode, "latency_ms", latency.Milliseconds())
+// healthyEndpoints drops the candidates that fail their health checks. When
+// none pass, all are kept: trying a possibly unhealthy upstream beats
+// refusing the request outright.
+func (h *Handler) healthyEndpoints(logger *slog.Logger, modelID string, candidates []string) []string {
+	if h.health == nil {
+		return candidates
+	}
+	healthy := make([]string, 0, len(candidates))
+	for _, u := range candidates {
+		if h.health.Healthy(modelID, u) {
+			healthy = append(healthy, u)
+		}
+	}
+	if len(healthy) == 0 {
+		logger.Warn("No healthy upstream, trying all candidates")
+		return candidates
+	}
+	return healthy
+}
+
+// trackedBody calls done once when the response body is closed.
+type trackedBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done()
+	return err
+}
 
-	// 7. Forward Response Headers
+// copyResponseHeaders forwards the upstream status and headers.
+func copyResponseHeaders(c *gin.Context, resp *http.Response) {
+	// Translated bodies change length; the server recomputes it
+	resp.Header.Del("Content-Length")
 	for k, vv := range resp.Header {
+		// The upstream's limits are the gateway's provider account's, not
+		// the tenant's, which the rate limiter reports
+		if strings.HasPrefix(strings.ToLower(k), "x-ratelimit-") {
+			continue
+		}
 		for _, v := range vv {
 			c.Header(k, v)
 		}
 	}
 	c.Status(resp.StatusCode)
+}
 
-	// Calculate Input Tokens (Approx)
-	inputLen := len(bodyBytes)
-	inputTokens := inputLen / 4
-
-	// 8. Handle Response Body (Streaming vs Non-Streaming)
-	var outputTokens int
-
-	if chatReq.Stream {
-		// Streaming Response
-		outputTokens = h.streamResponse(c, resp.Body, tenant.TenantID, chatReq.Model, start)
-	} else {
-		// Non-Streaming Response
-		body, _ := ioutil.ReadAll(resp.Body)
-		c.Writer.Write(body)
-		outputTokens = len(body) / 4
-	}
-
-	// 9. Update Metrics & Logs (Async)
-	// We do this AFTER response is done (streaming blocks until done)
-	// 9. Update Metrics & Logs (Async)
+// recordUsage settles the request's TPM reservation with u and persists the
+// usage record in the background, then updates the token metrics of the
+// served model.
+func (h *Handler) recordUsage(c *gin.Context, tenant *store.Tenant, reserved int, model, servedModel string, start time.Time, u Usage) {
+	tenantID := tenant.TenantID
 	// We do this AFTER response is done (streaming blocks until done)
 	h.wg.Add(1)
-	go func(tid, mid string, in, out int) {
+	go func() {
 		defer h.wg.Done()
 
 		// Update Rate Limit
-		estTokens := in + out
-		_, err := h.rlStore.IncrementTPM(context.Background(), tid, estTokens)
-		if err != nil {
-			slog.Error("Failed to increment TPM", "error", err)
-		}
+		h.settleTokens(tenant, model, reserved, u.InputTokens+u.OutputTokens)
 
 		// Log Usage Persistence
 		requestID := uuid.New().String()
 		usageRec := &store.UsageRecord{
-			TenantID:     tid,
-			Timestamp:    start.Format(time.RFC3339Nano),
-			RequestID:    requestID,
-			ModelID:      mid,
-			InputTokens:  in,
-			OutputTokens: out,
+			TenantID:        tenantID,
+			Timestamp:       start.Format(time.RFC3339Nano),
+			RequestID:       requestID,
+			ModelID:         model,
+			ServedModelID:   servedModel,
+			InputTokens:     u.InputTokens,
+			OutputTokens:    u.OutputTokens,
+			CachedTokens:    u.CachedTokens,
+			ReasoningTokens: u.ReasoningTokens,
+			UsageSource:     u.Source,
+			Partial:         u.Partial,
 		}
 
 		// Retry Logic (Simple backing off)
@@ -334,65 +654,85 @@ func (h *Handler) CreateCompletion(c *gin.Context) {
 			}
 			break
 		}
-	}(tenant.TenantID, chatReq.Model, inputTokens, outputTokens)
+	}()
 
 	// Prometheus Metrics
-	middleware.RecordTokenUsage(tenant.TenantID, chatReq.Model, inputTokens, outputTokens)
+	middleware.RecordTokenUsage(tenantID, servedModel, u.InputTokens, u.OutputTokens)
 
 	// Set model in context for metrics
-	c.Set("model", chatReq.Model)
+	c.Set("model", model)
 }
 
-// streamResponse forwards SSE events to client and counts tokens
-func (h *Handler) streamResponse(c *gin.Context, body io.Reader, tenantID, model string, start time.Time) int {
-	scanner := bufio.NewScanner(body)
-	outputTokens := 0
+// streamResponse forwards SSE events to client and counts tokens. The
+// format extracts the generated text and the usage object, if the upstream
+// sends one (OpenAI's stream_options.include_usage), from each data payload
+// and recognizes the terminal event. A stream that ends without one is
+// reported as interrupted.
+func (h *Handler) streamResponse(c *gin.Context, body io.Reader, tenantID, model string, start time.Time, tok tokenizer.Tokenizer, format responseFormat) (int, *openAIUsage, *streamInterruption) {
+	events := sse.NewReader(body)
+	var completion strings.Builder
+	var reported *openAIUsage
 	firstByte := true
+	ended := false
 
 	// Create a flushing writer
 	c.Writer.Flush()
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	var err error
+	for {
+		var ev *sse.Event
+		ev, err = events.Next()
+		if err != nil {
+			break
+		}
 
-		// Record TTFT on first line
+		// Record TTFT on first event
 		if firstByte {
 			ttft := time.Since(start).Seconds()
 			middleware.RecordTTFT(tenantID, model, ttft)
 			firstByte = false
 		}
 
-		// Write line to client immediately
-		c.Writer.WriteString(line + "\n")
+		// Write the event to the client immediately, keepalive comments
+		// included
+		c.Writer.Write(ev.Raw)
 		c.Writer.Flush()
 
 		// Token Counting Logic
-		// Check for "data: " prefix
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
-			if data == "[DONE]" {
-				continue
-			}
+		if ev.Data == nil {
+			continue
+		}
+		if format.streamEnd(ev.Data) {
+			ended = true
+		}
+		if isDone(ev.Data) {
+			continue
+		}
 
-			// Parse partial JSON to get content
-			// We only need choices[0].delta.content
-			// Optimization: Quick string search or lightweight JSON parser
-			// For robustness, lets use JSON (though slightly slower, it's safer)
-			var partial struct {
-				Choices []struct {
-					Delta struct {
-						Content string `json:"content"`
-					} `json:"delta"`
-				} `json:"choices"`
-			}
-			if err := json.Unmarshal([]byte(data), &partial); err == nil {
-				if len(partial.Choices) > 0 {
-					content := partial.Choices[0].Delta.Content
-					// Count tokens: rough approx len/4
-					outputTokens += len(content) / 4
-				}
-			}
+		// Deltas split tokens arbitrarily, so count once at the end
+		text, usage := format.streamEvent(ev.Data)
+		completion.WriteString(text)
+		if usage != nil {
+			reported = usage
+		}
+	}
+
+	outputTokens := tok.Count(completion.String())
+	if ended {
+		return outputTokens, reported, nil
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	reason := interruptTruncated
+	switch {
+	case c.Request.Context().Err() != nil:
+		reason = interruptClient
+	case err != nil:
+		reason = interruptError
+		if te, ok := asTimeout(err); ok {
+			reason = te.phase + "_timeout"
 		}
 	}
-	return outputTokens
+	return outputTokens, reported, &streamInterruption{reason: reason, err: err}
 }
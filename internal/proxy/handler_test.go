@@ -2,16 +2,22 @@ package proxy
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/openai"
 	"github.com/user/llm-gateway/internal/store"
+	"github.com/user/llm-gateway/internal/tokenizer"
 )
 
 func TestCreateCompletion_Validation(t *testing.T) {
@@ -53,6 +59,33 @@ func TestCreateCompletion_Validation(t *testing.T) {
 			},
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name:        "Multimodal Content And Tools",
+			requestBody: `{"model": "gpt-4", "temperature": 0.5, "tool_choice": "auto", "tools": [{"type": "function", "function": {"name": "lookup"}}], "messages": [{"role": "user", "content": [{"type": "text", "text": "what is this?"}, {"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}]}]}`,
+			tenant: &store.Tenant{
+				TenantID:      "t1",
+				AllowedModels: []string{"gpt-4"},
+			},
+			expectedStatus: http.StatusBadGateway, // Accepted, upstream unreachable
+		},
+		{
+			name:        "Out Of Range Temperature",
+			requestBody: `{"model": "gpt-4", "temperature": 3, "messages": [{"role": "user", "content": "hi"}]}`,
+			tenant: &store.Tenant{
+				TenantID:      "t1",
+				AllowedModels: []string{"gpt-4"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Wrong Field Type",
+			requestBody: `{"model": "gpt-4", "max_tokens": "ten", "messages": [{"role": "user", "content": "hi"}]}`,
+			tenant: &store.Tenant{
+				TenantID:      "t1",
+				AllowedModels: []string{"gpt-4"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:        "Too Many Messages",
 			requestBody: `{"model": "gpt-4", "messages": ` + makeLargeMessageList(60) + `}`,
@@ -138,7 +171,7 @@ func TestCreateCompletion_Streaming(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Hello")
 
 	// Wait for async usage log
-	time.Sleep(100 * time.Millisecond) // Give goroutine time to finish (or use WaitGroup if exposed)
+	require.NoError(t, h.Shutdown(context.Background()))
 
 	// Check Usage Log
 	assert.Len(t, mockUsage.Records, 1)
@@ -181,3 +214,240 @@ func makeLargeMessageList(n int) string {
 	s = s[:len(s)-1] + "]"
 	return s
 }
+
+func TestTokenCounting(t *testing.T) {
+	tok := tokenizer.Estimator{}
+
+	// Only roles and contents are counted, not JSON keys and punctuation
+	req := &openai.ChatRequest{Messages: []openai.Message{
+		{Role: "system", Content: openai.Content{Text: "be brief"}},
+		{Role: "user", Name: "bob", Content: openai.Content{Parts: []openai.ContentPart{
+			{Type: "text", Text: "hi"},
+			{Type: "image_url", ImageURL: &openai.ImageURL{URL: "https://example.com/a.png", Detail: "low"}},
+		}}},
+	}}
+	want := tokenizer.TokensPerReply +
+		tokenizer.TokensPerMessage + tok.Count("system") + tok.Count("be brief") +
+		tokenizer.TokensPerMessage + tok.Count("user") + tok.Count("hi") + lowDetailImageTokens +
+		tokenizer.TokensPerName + tok.Count("bob")
+	assert.Equal(t, want, countPromptTokens(tok, req))
+
+	body := []byte(`{"choices":[{"message":{"role":"assistant","content":"Hello World"}}]}`)
+	out, reported := parseCompletion(tok, body)
+	assert.Equal(t, tok.Count("Hello World"), out)
+	assert.Nil(t, reported)
+
+	// Every choice and the tool calls the model made are generated output
+	body = []byte(`{"choices":[
+		{"message":{"role":"assistant","content":"Hello World"}},
+		{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]}`)
+	out, _ = parseCompletion(tok, body)
+	assert.Equal(t, tok.Count("Hello World")+tok.Count(`get_weather{"city":"Paris"}`), out)
+}
+
+func TestCreateCompletion_ProviderUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		stream     bool
+		status     int
+		response   string
+		wantSource string
+		wantIn     int
+		wantOut    int
+		wantCached int
+	}{
+		{
+			name:       "Non-Streaming With Usage",
+			response:   `{"choices":[{"message":{"content":"Hello"}}],"usage":{"prompt_tokens":12,"completion_tokens":3,"prompt_tokens_details":{"cached_tokens":8}}}`,
+			wantSource: store.UsageSourceProvider,
+			wantIn:     12,
+			wantOut:    3,
+			wantCached: 8,
+		},
+		{
+			name:       "Streaming With Final Usage Chunk",
+			stream:     true,
+			response:   "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":5}}\n\ndata: [DONE]\n\n",
+			wantSource: store.UsageSourceProvider,
+			wantIn:     20,
+			wantOut:    5,
+		},
+		{
+			name:       "Non-Streaming Without Usage",
+			response:   `{"choices":[{"message":{"content":"Hello World"}}]}`,
+			wantSource: store.UsageSourceEstimated,
+			wantOut:    tokenizer.Estimator{}.Count("Hello World"),
+		},
+		{
+			name:   "Streaming Choices And Tool Calls Without Usage",
+			stream: true,
+			response: "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}},{\"index\":1,\"delta\":{\"content\":\"Yo\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Paris\\\"}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			wantSource: store.UsageSourceEstimated,
+			wantOut:    tokenizer.Estimator{}.Count(`HiYoget_weather{"city":"Paris"}`),
+		},
+		{
+			name:       "Upstream Error Generates Nothing",
+			status:     http.StatusBadRequest,
+			response:   `{"error":{"message":"Invalid 'messages': the conversation is far too long to be answered by this model.","type":"invalid_request_error"}}`,
+			wantSource: store.UsageSourceEstimated,
+			wantOut:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(cmp.Or(tt.status, http.StatusOK))
+				fmt.Fprint(w, tt.response)
+			}))
+			defer upstream.Close()
+
+			mockUsage := &store.MockUsageStore{}
+			mockModel := &store.MockModelStore{
+				Models: map[string]*store.Model{
+					"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{upstream.URL}},
+				},
+			}
+			h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 1*time.Second)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			reqBody := fmt.Sprintf(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "stream": %t}`, tt.stream)
+			c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+			c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+			h.CreateCompletion(c)
+			assert.NoError(t, h.Shutdown(context.Background()))
+
+			assert.Equal(t, cmp.Or(tt.status, http.StatusOK), w.Code)
+			if assert.Len(t, mockUsage.Records, 1) {
+				rec := mockUsage.Records[0]
+				assert.Equal(t, tt.wantSource, rec.UsageSource)
+				if tt.wantIn > 0 {
+					assert.Equal(t, tt.wantIn, rec.InputTokens)
+				} else {
+					assert.True(t, rec.InputTokens > 0, "Should estimate input tokens")
+				}
+				assert.Equal(t, tt.wantOut, rec.OutputTokens)
+				assert.Equal(t, tt.wantCached, rec.CachedTokens)
+			}
+		})
+	}
+}
+
+func TestCreateCompletion_AnthropicProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotPath, gotVersion string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotVersion = r.URL.Path, r.Header.Get("anthropic-version")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":9}}}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n")
+		fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":4}}\n\n")
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream.Close()
+
+	mockUsage := &store.MockUsageStore{}
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"claude": {ModelID: "claude", ProviderName: "anthropic", BaseURLs: []string{upstream.URL}},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 1*time.Second)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	reqBody := `{"model": "claude", "messages": [{"role": "user", "content": "hi"}], "stream": true}`
+	c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+	h.CreateCompletion(c)
+	assert.NoError(t, h.Shutdown(context.Background()))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/v1/messages", gotPath)
+	assert.NotEmpty(t, gotVersion)
+	assert.Contains(t, w.Body.String(), `"object":"chat.completion.chunk"`)
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+	if assert.Len(t, mockUsage.Records, 1) {
+		assert.Equal(t, store.UsageSourceProvider, mockUsage.Records[0].UsageSource)
+		assert.Equal(t, 9, mockUsage.Records[0].InputTokens)
+		assert.Equal(t, 4, mockUsage.Records[0].OutputTokens)
+	}
+}
+
+func TestCreateCompletion_UnsupportedByProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer upstream.Close()
+
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"claude": {ModelID: "claude", ProviderName: "anthropic", BaseURLs: []string{upstream.URL}},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 1*time.Second)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	reqBody := `{"model": "claude", "messages": [{"role": "user", "content": [{"type": "input_audio", "input_audio": {"data": "UklGRg==", "format": "wav"}}]}]}`
+	c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+	h.CreateCompletion(c)
+	assert.NoError(t, h.Shutdown(context.Background()))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp openai.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "invalid_request_error", resp.Error.Type)
+	assert.Equal(t, "messages[0].content[0].type", *resp.Error.Param)
+	assert.Zero(t, calls.Load(), "Nothing is sent upstream")
+}
+
+func TestCreateCompletion_GeminiStreamCounting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// No usageMetadata, so the gateway must count the converted stream itself
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hello\"}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\" World\"}]},\"finishReason\":\"STOP\"}]}\n\n")
+	}))
+	defer upstream.Close()
+
+	mockUsage := &store.MockUsageStore{}
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gemini": {ModelID: "gemini", ProviderName: "gemini", BaseURLs: []string{upstream.URL}},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 1*time.Second)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	reqBody := `{"model": "gemini", "messages": [{"role": "user", "content": "hi"}], "stream": true}`
+	c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(reqBody))
+	c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+	h.CreateCompletion(c)
+	assert.NoError(t, h.Shutdown(context.Background()))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+	if assert.Len(t, mockUsage.Records, 1) {
+		assert.Equal(t, store.UsageSourceEstimated, mockUsage.Records[0].UsageSource)
+		assert.Equal(t, tokenizer.Estimator{}.Count("Hello World"), mockUsage.Records[0].OutputTokens)
+	}
+}
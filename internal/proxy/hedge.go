@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/user/llm-gateway/internal/balancer"
+	"github.com/user/llm-gateway/internal/middleware"
+	"github.com/user/llm-gateway/internal/provider"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// defaultHedgePercentile is the latency percentile waited for before
+// hedging when the tenant's config does not set one.
+const defaultHedgePercentile = 0.95
+
+// upstreamCall is one request to an upstream endpoint.
+type upstreamCall struct {
+	url  string
+	resp *http.Response
+	err  error
+	ttfb time.Duration
+	// finish ends the balancer's in-flight tracking of the request.
+	finish func()
+}
+
+// buildError is a failure to create the upstream request, which retrying
+// cannot fix.
+type buildError struct {
+	err error
+}
+
+func (e *buildError) Error() string {
+	return "build upstream request: " + e.err.Error()
+}
+
+func (e *buildError) Unwrap() error {
+	return e.err
+}
+
+// sendFunc sends a request under ctx; cancel is called once its response
+// is released.
+type sendFunc func(ctx context.Context, cancel context.CancelFunc) *upstreamCall
+
+// call sends body to url within the limits of t. Closing the response body
+// calls cancel; without a response it is called straight away. done reports
+// the outcome to the endpoint's circuit breaker.
+func (h *Handler) call(ctx context.Context, cancel context.CancelFunc, lb *balancer.Balancer, adapter provider.Adapter, url string, body []byte, header http.Header, t timeouts, done func(success bool)) *upstreamCall {
+	bounded, release := t.bound(ctx)
+	stop := func() {
+		release()
+		cancel()
+	}
+
+	// Adapters add credentials to the header, and hedges run concurrently
+	req, err := adapter.BuildRequest(bounded, url, body, header.Clone())
+	if err != nil {
+		stop()
+		done(true) // Not the upstream's fault
+		return &upstreamCall{url: url, err: &buildError{err}, finish: func() {}}
+	}
+
+	finish := lb.Begin(url)
+	sent := time.Now()
+	resp, err := h.httpClient.Do(req)
+	if te, ok := timeoutCause(bounded); ok && err != nil {
+		err = te
+	}
+	// Network errors, timeouts and 5xx count against the endpoint;
+	// cancellations, by the client or of a losing hedge, say nothing about
+	// its health
+	done(ctx.Err() != nil || (err == nil && resp.StatusCode < 500))
+	if err != nil {
+		stop()
+		return &upstreamCall{url: url, err: err, finish: finish}
+	}
+	resp.Body = &trackedBody{ReadCloser: &boundedBody{ReadCloser: resp.Body, ctx: bounded}, done: stop}
+	return &upstreamCall{url: url, resp: resp, ttfb: time.Since(sent), finish: finish}
+}
+
+// discard releases a call whose outcome is not used.
+func (u *upstreamCall) discard() {
+	if u.resp != nil {
+		u.resp.Body.Close()
+	}
+	u.finish()
+}
+
+// hedgeTarget picks the endpoint a hedge of the request to current goes
+// to: the next candidate in order whose circuit breaker allows a request.
+func (h *Handler) hedgeTarget(logger *slog.Logger, modelConfig *store.Model, candidates []string, index int, current string, send func(url string, done func(bool)) sendFunc) (sendFunc, bool) {
+	for i := 1; i < len(candidates); i++ {
+		u := candidates[(index+i)%len(candidates)]
+		if u == current {
+			continue
+		}
+		done, err := h.breakers.get(modelConfig, u).Allow()
+		if err != nil {
+			continue
+		}
+		logger.Info("Upstream slow, sending hedged request", "url", current, "hedge_url", u)
+		return send(u, done), true
+	}
+	return nil, false
+}
+
+// hedgeDelay returns how long a tenant's request to the model may wait for
+// response headers before it is hedged, judged by requests that were
+// streamed alike. It reports false when the tenant does not hedge or the
+// model has too few latency samples yet.
+func hedgeDelay(tenant *store.Tenant, lb *balancer.Balancer, stream bool) (time.Duration, bool) {
+	cfg := tenant.Hedging
+	if cfg == nil {
+		return 0, false
+	}
+	p := cfg.Percentile
+	if p <= 0 || p >= 1 {
+		p = defaultHedgePercentile
+	}
+	d, ok := lb.LatencyPercentile(p, stream)
+	if !ok {
+		return 0, false
+	}
+	return max(d, time.Duration(cfg.MinDelayMs)*time.Millisecond), true
+}
+
+// hedged runs primary and, when it has not returned after delay, a hedge
+// from startHedge, which reports false when no endpoint can take one. The
+// first call accepted wins and the other is canceled, so only one response
+// is relayed and billed. When neither is accepted, the primary's outcome is
+// returned.
+func hedged(ctx context.Context, model string, delay time.Duration, primary sendFunc, startHedge func() (sendFunc, bool), accept func(*upstreamCall) bool) *upstreamCall {
+	type result struct {
+		hedge bool
+		call  *upstreamCall
+	}
+	results := make(chan result, 2)
+	var cancels []context.CancelFunc
+	launch := func(send sendFunc) {
+		callCtx, cancel := context.WithCancel(ctx)
+		isHedge := len(cancels) > 0
+		cancels = append(cancels, cancel)
+		go func() { results <- result{isHedge, send(callCtx, cancel)} }()
+	}
+
+	launch(primary)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.call
+	case <-timer.C:
+	}
+
+	send, ok := startHedge()
+	if !ok {
+		return (<-results).call
+	}
+	launch(send)
+
+	var failed [2]*upstreamCall
+	for pending := 2; pending > 0; pending-- {
+		r := <-results
+		if accept(r.call) {
+			winner, loser := "primary", 1
+			if r.hedge {
+				winner, loser = "hedge", 0
+			}
+			middleware.RecordHedge(model, winner)
+			cancels[loser]()
+			if pending > 1 {
+				go func() { (<-results).call.discard() }()
+			}
+			for _, f := range failed {
+				if f != nil {
+					f.discard()
+				}
+			}
+			return r.call
+		}
+		if r.hedge {
+			failed[1] = r.call
+		} else {
+			failed[0] = r.call
+		}
+	}
+
+	middleware.RecordHedge(model, "none")
+	failed[1].discard()
+	return failed[0]
+}
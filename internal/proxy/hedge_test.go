@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestCreateCompletion_Hedging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var slowHits, slowCanceled atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowHits.Add(1)
+		// The server only notices the client leaving once the body is read
+		io.ReadAll(r.Body)
+		select {
+		case <-time.After(500 * time.Millisecond):
+			w.Write([]byte(`{"choices":[{"message":{"content":"slow"}}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`))
+		case <-r.Context().Done():
+			slowCanceled.Add(1)
+		}
+	}))
+	defer slow.Close()
+
+	var fastHits atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastHits.Add(1)
+		w.Write([]byte(`{"choices":[{"message":{"content":"fast"}}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`))
+	}))
+	defer fast.Close()
+
+	model := &store.Model{ModelID: "gpt-4", BaseURLs: []string{slow.URL, fast.URL}}
+	mockModel := &store.MockModelStore{Models: map[string]*store.Model{"gpt-4": model}}
+
+	send := func(tenant *store.Tenant) (*httptest.ResponseRecorder, *store.MockUsageStore, time.Duration) {
+		mockUsage := &store.MockUsageStore{}
+		h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 5*time.Second)
+		// Recent non-streamed response times put the p95 at 20ms
+		lb := h.balancers.get(model)
+		for i := 0; i < 20; i++ {
+			lb.Observe(fast.URL, time.Duration(i+1)*time.Millisecond, false)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}]}`))
+		c.Set("tenant", tenant)
+
+		start := time.Now()
+		h.CreateCompletion(c)
+		require.NoError(t, h.Shutdown(context.Background()))
+		return w, mockUsage, time.Since(start)
+	}
+
+	t.Run("Hedge Wins And Bills Once", func(t *testing.T) {
+		w, mockUsage, elapsed := send(&store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}, Hedging: &store.HedgingConfig{Percentile: 0.95}})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "fast")
+		assert.Less(t, elapsed, 400*time.Millisecond, "Does not wait for the slow upstream")
+		assert.Equal(t, int32(1), slowHits.Load())
+		assert.Equal(t, int32(1), fastHits.Load())
+		assert.Eventually(t, func() bool { return slowCanceled.Load() == 1 }, time.Second, 10*time.Millisecond, "Losing request is canceled")
+		assert.Len(t, mockUsage.Records, 1)
+	})
+
+	t.Run("No Hedging Without Config", func(t *testing.T) {
+		slowHits.Store(0)
+		fastHits.Store(0)
+		w, mockUsage, _ := send(&store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "slow")
+		assert.Equal(t, int32(0), fastHits.Load())
+		assert.Len(t, mockUsage.Records, 1)
+	})
+}
+
+func TestHedged(t *testing.T) {
+	accept := func(u *upstreamCall) bool { return u.err == nil }
+	result := func(url string, err error, after time.Duration, finished *atomic.Int32) sendFunc {
+		return func(ctx context.Context, cancel context.CancelFunc) *upstreamCall {
+			defer cancel()
+			select {
+			case <-time.After(after):
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			return &upstreamCall{url: url, err: err, finish: func() { finished.Add(1) }}
+		}
+	}
+
+	t.Run("Primary Before Delay", func(t *testing.T) {
+		var finished atomic.Int32
+		hedgeStarted := false
+		call := hedged(context.Background(), "m", 50*time.Millisecond, result("a", nil, 0, &finished), func() (sendFunc, bool) {
+			hedgeStarted = true
+			return nil, false
+		}, accept)
+		assert.Equal(t, "a", call.url)
+		assert.False(t, hedgeStarted)
+	})
+
+	t.Run("Both Fail Returns Primary", func(t *testing.T) {
+		var finished atomic.Int32
+		call := hedged(context.Background(), "m", time.Millisecond, result("a", errors.New("a failed"), 20*time.Millisecond, &finished), func() (sendFunc, bool) {
+			return result("b", errors.New("b failed"), 0, &finished), true
+		}, accept)
+		assert.Equal(t, "a", call.url)
+		assert.EqualError(t, call.err, "a failed")
+		assert.Equal(t, int32(1), finished.Load(), "The failed hedge is released")
+	})
+
+	t.Run("Failed Hedge Waits For Primary", func(t *testing.T) {
+		var finished atomic.Int32
+		call := hedged(context.Background(), "m", time.Millisecond, result("a", nil, 20*time.Millisecond, &finished), func() (sendFunc, bool) {
+			return result("b", errors.New("b failed"), 0, &finished), true
+		}, accept)
+		assert.Equal(t, "a", call.url)
+		assert.NoError(t, call.err)
+	})
+}
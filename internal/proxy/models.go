@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/provider"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// modelObject is a model in OpenAI's /v1/models format.
+type modelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type modelList struct {
+	Object string        `json:"object"`
+	Data   []modelObject `json:"data"`
+}
+
+func newModelObject(m *store.Model) modelObject {
+	ownedBy := strings.ToLower(m.ProviderName)
+	if ownedBy == "" {
+		ownedBy = provider.OpenAI
+	}
+	return modelObject{
+		ID:      m.ModelID,
+		Object:  "model",
+		Created: m.Created,
+		OwnedBy: ownedBy,
+	}
+}
+
+// ListModels returns the models the tenant may use.
+func (h *Handler) ListModels(c *gin.Context) {
+	tenant, ok := tenantFromContext(c)
+	if !ok {
+		return
+	}
+
+	models, err := h.modelStore.ListModels(c.Request.Context())
+	if err != nil {
+		slog.Error("Failed to list models", "error", err, "tenant_id", tenant.TenantID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list models"})
+		return
+	}
+
+	list := modelList{Object: "list", Data: []modelObject{}}
+	for _, m := range models {
+		if modelAllowed(tenant, m.ModelID) {
+			list.Data = append(list.Data, newModelObject(m))
+		}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// RetrieveModel returns a single model. Models the tenant may not use are
+// reported as missing so their existence is not disclosed.
+func (h *Handler) RetrieveModel(c *gin.Context) {
+	tenant, ok := tenantFromContext(c)
+	if !ok {
+		return
+	}
+
+	// The route is a catch-all so IDs may contain slashes (e.g. "meta/llama-3")
+	modelID := strings.TrimPrefix(c.Param("id"), "/")
+	notFound := openai.ErrorResponse{Error: openai.InvalidRequest("model", "model_not_found", "The model '%s' does not exist or you do not have access to it.", modelID)}
+	if modelID == "" || !modelAllowed(tenant, modelID) {
+		c.JSON(http.StatusNotFound, notFound)
+		return
+	}
+
+	// ListModels is cached, unlike GetModel
+	models, err := h.modelStore.ListModels(c.Request.Context())
+	if err != nil {
+		slog.Error("Failed to list models", "error", err, "tenant_id", tenant.TenantID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list models"})
+		return
+	}
+	for _, m := range models {
+		if m.ModelID == modelID {
+			c.JSON(http.StatusOK, newModelObject(m))
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, notFound)
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestModelsEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4o":       {ModelID: "gpt-4o", Created: 1715367049},
+			"claude":       {ModelID: "claude", ProviderName: "Anthropic"},
+			"meta/llama-3": {ModelID: "meta/llama-3"},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 1*time.Second)
+
+	newRouter := func(allowed ...string) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: allowed})
+		})
+		r.GET("/v1/models", h.ListModels)
+		r.GET("/v1/models/*id", h.RetrieveModel)
+		return r
+	}
+	get := func(r *gin.Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("List Filtered By Tenant", func(t *testing.T) {
+		w := get(newRouter("gpt-4o", "meta/llama-3"), "/v1/models")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var list modelList
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.Equal(t, "list", list.Object)
+		assert.Equal(t, []modelObject{
+			{ID: "gpt-4o", Object: "model", Created: 1715367049, OwnedBy: "openai"},
+			{ID: "meta/llama-3", Object: "model", OwnedBy: "openai"},
+		}, list.Data)
+	})
+
+	t.Run("List Wildcard", func(t *testing.T) {
+		w := get(newRouter("*"), "/v1/models")
+		var list modelList
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.Len(t, list.Data, 3)
+	})
+
+	t.Run("List Empty", func(t *testing.T) {
+		w := get(newRouter(), "/v1/models")
+		assert.JSONEq(t, `{"object":"list","data":[]}`, w.Body.String())
+	})
+
+	t.Run("Retrieve", func(t *testing.T) {
+		w := get(newRouter("*"), "/v1/models/claude")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"id":"claude","object":"model","created":0,"owned_by":"anthropic"}`, w.Body.String())
+
+		w = get(newRouter("*"), "/v1/models/meta/llama-3")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":"meta/llama-3"`)
+	})
+
+	t.Run("Retrieve Not Allowed", func(t *testing.T) {
+		w := get(newRouter("gpt-4o"), "/v1/models/claude")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"model_not_found"`)
+	})
+
+	t.Run("Retrieve Unknown", func(t *testing.T) {
+		w := get(newRouter("*"), "/v1/models/nope")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
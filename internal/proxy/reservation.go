@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/middleware"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// defaultOutputReservation is reserved for the output of requests that do
+// not cap it.
+const defaultOutputReservation = 1024
+
+// outputReservation returns the output tokens to reserve for a request
+// whose output is capped at maxTokens (nil when uncapped) per generation.
+// counts are the request's n and best_of, when set: the upstream generates
+// as many completions as the largest of them.
+func outputReservation(maxTokens *int, counts ...*int) int {
+	perGeneration := defaultOutputReservation
+	if maxTokens != nil {
+		perGeneration = *maxTokens
+	}
+	generations := 1
+	for _, n := range counts {
+		if n != nil {
+			generations = max(generations, *n)
+		}
+	}
+	return perGeneration * generations
+}
+
+// reserveTokens reserves a request's estimated tokens, its prompt plus its
+// maximum output, against the tenant's TPM limit for model before it is
+// forwarded, so concurrent requests cannot together overshoot the limit. It
+// replies 429 and returns false when the reservation does not fit.
+func (h *Handler) reserveTokens(c *gin.Context, logger *slog.Logger, tenant *store.Tenant, model string, tokens int) bool {
+	limits := tenant.RateLimitsFor(model)
+	if limits.TPMLimit > 0 && tokens > limits.TPMLimit {
+		logger.Warn("Request exceeds TPM limit", "limit", limits.TPMLimit, "requested", tokens)
+		middleware.RecordRateLimited(tenant.TenantID, model, "tpm")
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":     "Request too large (TPM)",
+			"limit":     limits.TPMLimit,
+			"requested": tokens,
+		})
+		return false
+	}
+
+	tpm, err := h.rlStore.ReserveTokens(c.Request.Context(), tenant.TenantID, limits.Model, tokens, limits.TPMLimit)
+	if err != nil {
+		// Fail closed, like the rate limit middleware
+		logger.Error("TPM reservation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limit check failed (TPM)"})
+		return false
+	}
+	// The quota left once this request is counted
+	middleware.SetRateLimitHeaders(c, "tokens", tpm)
+	if !tpm.Allowed {
+		logger.Warn("Rate limit exceeded (TPM)", "limit", limits.TPMLimit, "requested", tokens, "retry_after", tpm.RetryAfter)
+		middleware.RecordRateLimited(tenant.TenantID, model, "tpm")
+		middleware.SetRetryAfter(c, tpm)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "Rate limit exceeded (TPM)",
+			"limit": limits.TPMLimit,
+		})
+		return false
+	}
+	return true
+}
+
+// settleTokens reconciles a reservation with the tokens the request used.
+func (h *Handler) settleTokens(tenant *store.Tenant, model string, reserved, used int) {
+	if reserved == used {
+		return
+	}
+	limits := tenant.RateLimitsFor(model)
+	if _, err := h.rlStore.CommitTokens(context.Background(), tenant.TenantID, limits.Model, reserved, used, limits.TPMLimit); err != nil {
+		slog.Error("Failed to settle TPM reservation", "error", err, "tenant_id", tenant.TenantID, "model", model, "reserved", reserved, "used", used)
+	}
+}
+
+// refundTokens returns the reservation of a request no upstream served, in
+// the background.
+func (h *Handler) refundTokens(tenant *store.Tenant, model string, reserved int) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.settleTokens(tenant, model, reserved, 0)
+	}()
+}
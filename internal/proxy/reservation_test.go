@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestOutputReservation(t *testing.T) {
+	n := func(v int) *int { return &v }
+
+	assert.Equal(t, defaultOutputReservation, outputReservation(nil))
+	assert.Equal(t, 100, outputReservation(n(100), nil))
+	assert.Equal(t, 800, outputReservation(n(100), n(8)), "n completions")
+	assert.Equal(t, 8*defaultOutputReservation, outputReservation(nil, n(8)))
+	assert.Equal(t, 500, outputReservation(n(100), n(2), n(5)), "best_of generates more than n returns")
+}
+
+func TestCreateCompletion_ReservesTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var hits atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("X-Test-Wait") != "" {
+			<-release
+		}
+		if r.Header.Get("X-Test-Fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// The gateway's own provider quota is not the tenant's business
+		w.Header().Set("x-ratelimit-remaining-tokens", "123456")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`))
+	}))
+	defer upstream.Close()
+
+	mockModel := &store.MockModelStore{Models: map[string]*store.Model{"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{upstream.URL}}}}
+	rlStore := store.NewMockRateLimitStore()
+	h := NewHandler(rlStore, mockModel, &store.MockUsageStore{}, 5*time.Second)
+	tenant := &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}, TPMLimit: 1000}
+
+	send := func(body string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		for k, v := range header {
+			c.Request.Header[k] = v
+		}
+		c.Request.Header.Set("X-LLM-Retry-Max", "0")
+		c.Set("tenant", tenant)
+		h.CreateCompletion(c)
+		return w
+	}
+	remaining := func() int64 {
+		require.NoError(t, h.Shutdown(context.Background()))
+		r, err := rlStore.CheckTokens(context.Background(), "t1", "", tenant.TPMLimit)
+		require.NoError(t, err)
+		return r.Remaining
+	}
+	const large = `{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "max_tokens": 600}`
+
+	t.Run("Concurrent Requests Cannot Overshoot", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- send(large, http.Header{"X-Test-Wait": {"1"}}) }()
+		require.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+		// The first request's 600 tokens are held while it runs
+		w := send(large, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "Rate limit exceeded (TPM)")
+		assert.Equal(t, int32(1), hits.Load(), "Rejected before reaching the upstream")
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		close(release)
+		w = <-done
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1000", w.Header().Get("x-ratelimit-limit-tokens"))
+		remainingHeader, err := strconv.Atoi(w.Header().Get("x-ratelimit-remaining-tokens"))
+		require.NoError(t, err)
+		assert.InDelta(t, 400-10, remainingHeader, 10, "The quota left after the reservation, not the upstream's")
+		// Settled to the 15 tokens reported
+		assert.InDelta(t, 985, remaining(), 1)
+	})
+
+	t.Run("Request Larger Than Limit", func(t *testing.T) {
+		hits.Store(0)
+		w := send(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "max_tokens": 2000}`, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "Request too large (TPM)")
+		assert.Equal(t, int32(0), hits.Load())
+	})
+
+	t.Run("Every Choice Is Reserved", func(t *testing.T) {
+		hits.Store(0)
+		w := send(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "max_tokens": 200, "n": 8}`, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "Request too large (TPM)")
+		assert.Equal(t, int32(0), hits.Load())
+	})
+
+	t.Run("Failed Request Is Refunded", func(t *testing.T) {
+		before := remaining()
+		w := send(large, http.Header{"X-Test-Fail": {"1"}})
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.InDelta(t, before, remaining(), 1)
+	})
+
+	t.Run("Model Limits", func(t *testing.T) {
+		tenant.ModelLimits = map[string]store.ModelLimit{"gpt-4": {TPMLimit: 500}}
+		defer func() { tenant.ModelLimits = nil }()
+		before := remaining()
+
+		w := send(large, nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), `"limit":500`)
+
+		w = send(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "max_tokens": 100}`, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "500", w.Header().Get("x-ratelimit-limit-tokens"))
+
+		assert.InDelta(t, before, remaining(), 1, "The tenant's shared budget is untouched")
+		r, err := rlStore.CheckTokens(context.Background(), "t1", "gpt-4", 500)
+		require.NoError(t, err)
+		assert.InDelta(t, 485, r.Remaining, 1)
+	})
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/provider"
+)
+
+// CreateResponse proxies the OpenAI Responses API (/v1/responses)
+// through the same pipeline as chat completions. Streams carry Responses
+// events (response.output_text.delta, response.completed, ...).
+func (h *Handler) CreateResponse(c *gin.Context) {
+	start := time.Now()
+	tenant, ok := tenantFromContext(c)
+	if !ok {
+		return
+	}
+
+	bodyBytes, ok := readBody(c, tenant)
+	if !ok {
+		return
+	}
+
+	respReq, apiErr := openai.DecodeResponsesRequest(bodyBytes)
+	if apiErr != nil {
+		slog.Warn("Invalid JSON body", "error", apiErr, "tenant_id", tenant.TenantID)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	logger := slog.With("tenant_id", tenant.TenantID, "model", respReq.Model)
+
+	if !modelAllowed(tenant, respReq.Model) {
+		logger.Warn("Model not allowed for this tenant")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Model not allowed for this tenant"})
+		return
+	}
+
+	if apiErr := respReq.Validate(); apiErr != nil {
+		logger.Warn("Invalid responses request", "error", apiErr)
+		c.JSON(http.StatusBadRequest, openai.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	requested, adapter, ok := h.resolveModel(c, logger, respReq.Model, provider.Responses)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquireSlot(c, logger, tenant, respReq.Model)
+	if !ok {
+		return
+	}
+	defer release()
+
+	tok := h.tokenizers.Get(requested.Tokenizer)
+	inputTokens := countResponsesInput(tok, respReq)
+	reserved := inputTokens + outputReservation(respReq.MaxOutputTokens)
+	if !h.reserveTokens(c, logger, tenant, respReq.Model, reserved) {
+		return
+	}
+
+	modelConfig, adapter, resp, ok := h.dispatch(c, logger, tenant, requested, adapter, provider.Responses, bodyBytes, respReq.Stream)
+	if !ok {
+		h.refundTokens(tenant, respReq.Model, reserved)
+		return
+	}
+	defer resp.Body.Close()
+
+	latency := time.Since(start)
+	logger.Info("Proxy request completed", "status", resp.StatusCode, "latency_ms", latency.Milliseconds())
+
+	copyResponseHeaders(c, resp)
+
+	if modelConfig.Tokenizer != requested.Tokenizer {
+		tok = h.tokenizers.Get(modelConfig.Tokenizer)
+		inputTokens = countResponsesInput(tok, respReq)
+	}
+	usage := h.relayResponse(c, logger, resp, adapter, respReq.Stream, tenant.TenantID, modelConfig, start, tok, inputTokens, responsesFormat)
+
+	h.recordUsage(c, tenant, reserved, respReq.Model, modelConfig.ModelID, start, usage)
+}
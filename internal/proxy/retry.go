@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/llm-gateway/internal/store"
+)
+
+const (
+	defaultRetryMax     = 3
+	defaultRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+	// maxRetries caps configured policies as well as the defaults.
+	maxRetries = 10
+	// defaultRetryBudget bounds the time a request spends in retries, waits
+	// included, so Retry-After hints cannot hold a client indefinitely.
+	defaultRetryBudget = 30 * time.Second
+	// maxDrainBytes is how much of a failed response is read so its
+	// connection can be reused; larger bodies are closed unread.
+	maxDrainBytes = 64 << 10
+	// statusClientClosedRequest is nginx's status for requests the client
+	// abandoned. Nobody reads the reply; it shows in logs and metrics.
+	statusClientClosedRequest = 499
+)
+
+// retryPolicy controls how forward retries failed upstream attempts.
+type retryPolicy struct {
+	maxRetries     int
+	baseBackoff    time.Duration
+	maxBackoff     time.Duration
+	budget         time.Duration
+	retryOnTimeout bool
+	// retryable lists the retried statuses; nil retries 429 and 5xx.
+	retryable map[int]bool
+}
+
+// newRetryPolicy merges the tenant's and the model's retry policies over
+// the gateway defaults, keeping the less aggressive value of each field
+// where both set one: fewer attempts, longer backoffs, fewer retryable
+// statuses. The X-LLM-Retry-Max and X-LLM-Retry-Backoff-Ms headers can then
+// only tighten the result.
+func newRetryPolicy(tenant *store.Tenant, model *store.Model, header http.Header) retryPolicy {
+	p := retryPolicy{
+		maxRetries:     defaultRetryMax,
+		baseBackoff:    defaultRetryBackoff,
+		maxBackoff:     maxRetryBackoff,
+		budget:         defaultRetryBudget,
+		retryOnTimeout: true,
+	}
+
+	var attempts, baseMs, maxMs int
+	var statuses map[int]bool
+	for _, cfg := range []*store.RetryPolicy{tenant.RetryPolicy, model.RetryPolicy} {
+		if cfg == nil {
+			continue
+		}
+		if cfg.MaxAttempts > 0 && (attempts == 0 || cfg.MaxAttempts < attempts) {
+			attempts = cfg.MaxAttempts
+		}
+		baseMs = max(baseMs, cfg.BaseBackoffMs)
+		maxMs = max(maxMs, cfg.MaxBackoffMs)
+		if cfg.RetryableStatuses != nil {
+			statuses = intersectStatuses(statuses, cfg.RetryableStatuses)
+		}
+		if cfg.RetryOnTimeout != nil && !*cfg.RetryOnTimeout {
+			p.retryOnTimeout = false
+		}
+	}
+	if attempts > 0 {
+		p.maxRetries = min(attempts-1, maxRetries)
+	}
+	if baseMs > 0 {
+		p.baseBackoff = time.Duration(baseMs) * time.Millisecond
+	}
+	if maxMs > 0 {
+		p.maxBackoff = time.Duration(maxMs) * time.Millisecond
+	}
+	p.retryable = statuses
+
+	if v := header.Get("X-LLM-Retry-Max"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			p.maxRetries = min(p.maxRetries, n)
+		}
+	}
+	if v := header.Get("X-LLM-Retry-Backoff-Ms"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+			p.baseBackoff = max(p.baseBackoff, time.Duration(ms)*time.Millisecond)
+		}
+	}
+	p.baseBackoff = min(p.baseBackoff, p.maxBackoff)
+	return p
+}
+
+// intersectStatuses returns the statuses in both set and list; a nil set
+// stands for every status.
+func intersectStatuses(set map[int]bool, list []int) map[int]bool {
+	out := make(map[int]bool, len(list))
+	for _, code := range list {
+		if set == nil || set[code] {
+			out[code] = true
+		}
+	}
+	return out
+}
+
+// retryStatus reports whether an upstream response with status code is
+// retried.
+func (p retryPolicy) retryStatus(code int) bool {
+	if p.retryable == nil {
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return p.retryable[code]
+}
+
+// retries reports whether a failed attempt, with either its response or
+// its transport error, is retried.
+func (p retryPolicy) retries(resp *http.Response, err error) bool {
+	if err != nil {
+		return p.retryOnTimeout || !isTimeout(err)
+	}
+	return p.retryStatus(resp.StatusCode)
+}
+
+// isTimeout reports whether err is a dial, TLS, first byte, stream idle or
+// total timeout of the attempt, or a client timeout.
+func isTimeout(err error) bool {
+	if _, ok := asTimeout(err); ok {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// backoff returns the wait before retry n (1-based): a uniformly random
+// duration up to the exponential backoff ("full jitter"), so clients that
+// failed together do not retry together.
+func (p retryPolicy) backoff(n int) time.Duration {
+	ceiling := p.baseBackoff
+	for i := 1; i < n && ceiling < p.maxBackoff; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, p.maxBackoff)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// retryAfter returns how long the upstream asked to wait before the next
+// request: Retry-After (seconds or an HTTP date), retry-after-ms, or the
+// reset time of an exhausted x-ratelimit-* budget.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if v := header.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+
+	// OpenAI-style limits, e.g. x-ratelimit-reset-tokens: 6m0s. Only the
+	// exhausted limits say when a retry can succeed.
+	var wait time.Duration
+	found := false
+	for _, limit := range []string{"requests", "tokens"} {
+		if header.Get("X-Ratelimit-Remaining-"+limit) != "0" {
+			continue
+		}
+		d, err := time.ParseDuration(header.Get("X-Ratelimit-Reset-" + limit))
+		if err != nil {
+			continue
+		}
+		wait = max(wait, d)
+		found = true
+	}
+	return wait, found
+}
+
+// sleepContext waits for d, returning early with the context's error if it
+// is canceled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainAndClose discards what is left of a response body and closes it, so
+// the connection returns to the pool.
+func drainAndClose(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+}
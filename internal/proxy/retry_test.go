@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := retryPolicy{baseBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, p.backoff(1), 100*time.Millisecond)
+		assert.LessOrEqual(t, p.backoff(3), 400*time.Millisecond)
+		assert.LessOrEqual(t, p.backoff(30), time.Second, "Capped at maxBackoff")
+		assert.GreaterOrEqual(t, p.backoff(2), time.Duration(0))
+	}
+	assert.Equal(t, time.Duration(0), retryPolicy{}.backoff(3))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		wantOK bool
+	}{
+		{"Seconds", http.Header{"Retry-After": {"3"}}, 3 * time.Second, true},
+		{"HTTP Date", http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, 90 * time.Second, true},
+		{"Past Date", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0, true},
+		{"Milliseconds", http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"1"}}, 250 * time.Millisecond, true},
+		{"Exhausted Token Limit", http.Header{
+			"X-Ratelimit-Remaining-Requests": {"10"},
+			"X-Ratelimit-Reset-Requests":     {"1s"},
+			"X-Ratelimit-Remaining-Tokens":   {"0"},
+			"X-Ratelimit-Reset-Tokens":       {"6m0s"},
+		}, 6 * time.Minute, true},
+		{"Limits Not Exhausted", http.Header{"X-Ratelimit-Remaining-Requests": {"10"}, "X-Ratelimit-Reset-Requests": {"1s"}}, 0, false},
+		{"Invalid", http.Header{"Retry-After": {"soon"}}, 0, false},
+		{"None", http.Header{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfter(tt.header, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// retryUpstream answers with the given statuses in turn, then 200, and
+// counts requests and new connections.
+func retryUpstream(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	var hits, conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(hits.Add(1))
+		if n <= len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+			w.Write(bytes.Repeat([]byte("x"), 1024))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, &hits, &conns
+}
+
+func sendChat(h *Handler, ctx context.Context, retryMax string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequestWithContext(ctx, "POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}]}`))
+	c.Request.Header.Set("X-LLM-Retry-Max", retryMax)
+	c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+	h.CreateCompletion(c)
+	return w
+}
+
+func newRetryHandler(urls ...string) *Handler {
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {ModelID: "gpt-4", BaseURLs: urls},
+		},
+	}
+	return NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 5*time.Second)
+}
+
+func TestForward_RetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Waits For Retry-After And Reuses Connection", func(t *testing.T) {
+		upstream, hits, conns := retryUpstream(t, http.Header{"Retry-After-Ms": {"200"}}, 429, 503)
+		h := newRetryHandler(upstream.URL)
+
+		start := time.Now()
+		w := sendChat(h, context.Background(), "3")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(3), hits.Load())
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond, "Each retry waits for Retry-After")
+		assert.Equal(t, int32(1), conns.Load(), "Failed responses are drained so the connection is reused")
+	})
+
+	t.Run("Retry-After Beyond Budget Returns Response", func(t *testing.T) {
+		upstream, hits, _ := retryUpstream(t, http.Header{"Retry-After": {"3600"}}, 429)
+		h := newRetryHandler(upstream.URL)
+
+		start := time.Now()
+		w := sendChat(h, context.Background(), "3")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, int32(1), hits.Load())
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Fails Over Without Waiting", func(t *testing.T) {
+		limited, limitedHits, _ := retryUpstream(t, http.Header{"Retry-After": {"3600"}}, 429)
+		backup, backupHits, _ := retryUpstream(t, nil)
+		h := newRetryHandler(limited.URL, backup.URL)
+
+		start := time.Now()
+		w := sendChat(h, context.Background(), "3")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(1), limitedHits.Load())
+		assert.Equal(t, int32(1), backupHits.Load())
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Client Cancellation Stops Retries", func(t *testing.T) {
+		upstream, hits, _ := retryUpstream(t, http.Header{"Retry-After": {"10"}}, 503, 503)
+		h := newRetryHandler(upstream.URL)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		w := sendChat(h, ctx, "3")
+		assert.Equal(t, statusClientClosedRequest, w.Code)
+		assert.Equal(t, int32(1), hits.Load())
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	no := false
+	tests := []struct {
+		name        string
+		tenant      *store.RetryPolicy
+		model       *store.RetryPolicy
+		header      http.Header
+		wantRetries int
+		wantBase    time.Duration
+		wantMax     time.Duration
+		wantTimeout bool
+	}{
+		{
+			name:        "Defaults",
+			wantRetries: defaultRetryMax, wantBase: defaultRetryBackoff, wantMax: maxRetryBackoff, wantTimeout: true,
+		},
+		{
+			name:        "Tenant Raises Defaults",
+			tenant:      &store.RetryPolicy{MaxAttempts: 6, BaseBackoffMs: 50, MaxBackoffMs: 20000},
+			wantRetries: 5, wantBase: 50 * time.Millisecond, wantMax: 20 * time.Second, wantTimeout: true,
+		},
+		{
+			name:        "Less Aggressive Of Tenant And Model",
+			tenant:      &store.RetryPolicy{MaxAttempts: 6, BaseBackoffMs: 50, RetryOnTimeout: &no},
+			model:       &store.RetryPolicy{MaxAttempts: 2, BaseBackoffMs: 200, MaxBackoffMs: 1000},
+			wantRetries: 1, wantBase: 200 * time.Millisecond, wantMax: time.Second, wantTimeout: false,
+		},
+		{
+			name:        "Configured Attempts Are Capped",
+			model:       &store.RetryPolicy{MaxAttempts: 100},
+			wantRetries: maxRetries, wantBase: defaultRetryBackoff, wantMax: maxRetryBackoff, wantTimeout: true,
+		},
+		{
+			name:        "Headers Only Tighten",
+			tenant:      &store.RetryPolicy{MaxAttempts: 3, BaseBackoffMs: 200},
+			header:      http.Header{"X-Llm-Retry-Max": {"1"}, "X-Llm-Retry-Backoff-Ms": {"500"}},
+			wantRetries: 1, wantBase: 500 * time.Millisecond, wantMax: maxRetryBackoff, wantTimeout: true,
+		},
+		{
+			name:        "Headers Cannot Loosen",
+			tenant:      &store.RetryPolicy{MaxAttempts: 3, BaseBackoffMs: 200},
+			header:      http.Header{"X-Llm-Retry-Max": {"10"}, "X-Llm-Retry-Backoff-Ms": {"0"}},
+			wantRetries: 2, wantBase: 200 * time.Millisecond, wantMax: maxRetryBackoff, wantTimeout: true,
+		},
+		{
+			name:        "Backoff Header Capped At Max Backoff",
+			header:      http.Header{"X-Llm-Retry-Backoff-Ms": {"60000"}},
+			wantRetries: defaultRetryMax, wantBase: maxRetryBackoff, wantMax: maxRetryBackoff, wantTimeout: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRetryPolicy(&store.Tenant{RetryPolicy: tt.tenant}, &store.Model{RetryPolicy: tt.model}, tt.header)
+			assert.Equal(t, tt.wantRetries, p.maxRetries)
+			assert.Equal(t, tt.wantBase, p.baseBackoff)
+			assert.Equal(t, tt.wantMax, p.maxBackoff)
+			assert.Equal(t, tt.wantTimeout, p.retryOnTimeout)
+		})
+	}
+}
+
+func TestRetryPolicy_RetryableStatuses(t *testing.T) {
+	p := newRetryPolicy(&store.Tenant{}, &store.Model{}, nil)
+	assert.True(t, p.retryStatus(429))
+	assert.True(t, p.retryStatus(502))
+	assert.False(t, p.retryStatus(400))
+
+	p = newRetryPolicy(
+		&store.Tenant{RetryPolicy: &store.RetryPolicy{RetryableStatuses: []int{408, 429, 503}}},
+		&store.Model{RetryPolicy: &store.RetryPolicy{RetryableStatuses: []int{408, 502, 503}}},
+		nil,
+	)
+	assert.True(t, p.retryStatus(408))
+	assert.True(t, p.retryStatus(503))
+	assert.False(t, p.retryStatus(429), "Only statuses retryable for both are retried")
+	assert.False(t, p.retryStatus(502))
+
+	timeout := &net.OpError{Op: "dial", Err: context.DeadlineExceeded}
+	assert.True(t, isTimeout(timeout))
+	assert.True(t, p.retries(nil, timeout))
+	p.retryOnTimeout = false
+	assert.False(t, p.retries(nil, timeout))
+	assert.True(t, p.retries(nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+}
+
+func TestForward_RetryPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream, hits, _ := retryUpstream(t, nil, 500, 429, 503)
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {ModelID: "gpt-4", BaseURLs: []string{upstream.URL}, RetryPolicy: &store.RetryPolicy{BaseBackoffMs: 1, RetryableStatuses: []int{503}}},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, &store.MockUsageStore{}, 5*time.Second)
+
+	// 500 is not retryable: the upstream error is final
+	w := sendChat(h, context.Background(), "3")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, int32(1), hits.Load())
+
+	// Neither is 429, which is returned to the client
+	w = sendChat(h, context.Background(), "3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, int32(2), hits.Load())
+
+	// 503 is retried
+	w = sendChat(h, context.Background(), "3")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(4), hits.Load())
+}
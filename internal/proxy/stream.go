@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// errStreamEmpty means the upstream accepted a streaming request but closed
+// the stream without sending anything.
+var errStreamEmpty = errors.New("upstream stream ended before sending data")
+
+// Reasons a stream ended before its terminal event, reported in logs and
+// the llm_stream_interruptions_total metric. Timeouts are reported as
+// "<phase>_timeout", e.g. "idle_timeout".
+const (
+	interruptError     = "upstream_error"
+	interruptTruncated = "truncated"
+	interruptClient    = "client_closed"
+)
+
+// streamInterruption describes a stream that ended before its terminal
+// event ("data: [DONE]" or the API's final event).
+type streamInterruption struct {
+	reason string
+	err    error
+}
+
+// idleReader fails a stream that sends nothing for timeout: abort unblocks
+// the pending read, which then returns an idle timeoutError. A zero timeout
+// disables the check.
+type idleReader struct {
+	r        io.Reader
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration, abort func()) *idleReader {
+	ir := &idleReader{r: r, timeout: timeout}
+	if timeout > 0 {
+		ir.timer = time.AfterFunc(timeout, func() {
+			ir.timedOut.Store(true)
+			abort()
+		})
+	}
+	return ir
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if ir.timedOut.Load() {
+		return n, &timeoutError{phase: phaseIdle, after: ir.timeout}
+	}
+	if n > 0 && ir.timer != nil {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
+
+// stop ends the idle check.
+func (ir *idleReader) stop() {
+	if ir.timer != nil {
+		ir.timer.Stop()
+	}
+}
+
+// primedBody replays the bytes read by primeStream before the rest of the
+// body.
+type primedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// primeStream waits for the first bytes of a streaming response. Until they
+// arrive nothing has been sent to the client, so a stream that fails here
+// can still be retried on another upstream.
+func primeStream(resp *http.Response, timeout time.Duration) error {
+	body := resp.Body
+	ir := newIdleReader(body, timeout, func() { body.Close() })
+	defer ir.stop()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := ir.Read(buf)
+		if n > 0 {
+			resp.Body = &primedBody{Reader: io.MultiReader(bytes.NewReader(buf[:n]), body), Closer: body}
+			return nil
+		}
+		if err == io.EOF {
+			return errStreamEmpty
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isDone reports whether data is the "[DONE]" sentinel ending chat and
+// legacy completion streams.
+func isDone(data []byte) bool {
+	return bytes.Equal(data, []byte("[DONE]"))
+}
+
+// chatStreamError is the SSE event that tells chat and legacy completion
+// clients the stream failed, shaped like an OpenAI error response.
+func chatStreamError(code, message string) string {
+	data, _ := json.Marshal(map[string]any{
+		"error": map[string]any{"message": message, "type": "server_error", "param": nil, "code": code},
+	})
+	return fmt.Sprintf("data: %s\n\n", data)
+}
+
+// responsesStreamEnd reports whether data is a terminal Responses API
+// event.
+func responsesStreamEnd(data []byte) bool {
+	var event struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return false
+	}
+	switch event.Type {
+	case "response.completed", "response.incomplete", "response.failed", "error":
+		return true
+	}
+	return false
+}
+
+// responsesStreamError is the Responses API "error" event.
+func responsesStreamError(code, message string) string {
+	data, _ := json.Marshal(map[string]any{"type": "error", "code": code, "message": message, "param": nil})
+	return fmt.Sprintf("event: error\ndata: %s\n\n", data)
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+const helloChunk = "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n"
+
+func streamChat(t *testing.T, idle time.Duration, urls ...string) (*httptest.ResponseRecorder, *store.MockUsageStore) {
+	t.Helper()
+	mockUsage := &store.MockUsageStore{}
+	mockModel := &store.MockModelStore{
+		Models: map[string]*store.Model{
+			"gpt-4": {ModelID: "gpt-4", BaseURLs: urls},
+		},
+	}
+	h := NewHandler(store.NewMockRateLimitStore(), mockModel, mockUsage, 5*time.Second)
+	h.streamIdleTimeout = idle
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "stream": true}`))
+	c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+	h.CreateCompletion(c)
+	require.NoError(t, h.Shutdown(context.Background()))
+	return w, mockUsage
+}
+
+func TestStreamResponse_Interrupted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Truncated Stream", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, helloChunk)
+		}))
+		defer upstream.Close()
+
+		w, mockUsage := streamChat(t, time.Second, upstream.URL)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte(helloChunk)))
+		assert.Contains(t, w.Body.String(), `data: {"error":{"code":"stream_interrupted","message":"The upstream stream ended unexpectedly (truncated).","param":null,"type":"server_error"}}`)
+		if assert.Len(t, mockUsage.Records, 1) {
+			assert.True(t, mockUsage.Records[0].Partial)
+			assert.Equal(t, 2, mockUsage.Records[0].OutputTokens, "Partial output is billed")
+		}
+	})
+
+	t.Run("Idle Stream", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, helloChunk)
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer upstream.Close()
+
+		start := time.Now()
+		w, mockUsage := streamChat(t, 100*time.Millisecond, upstream.URL)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Contains(t, w.Body.String(), "(idle_timeout)")
+		if assert.Len(t, mockUsage.Records, 1) {
+			assert.True(t, mockUsage.Records[0].Partial)
+		}
+	})
+
+	t.Run("Complete Stream", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, helloChunk+"data: [DONE]\n\n")
+		}))
+		defer upstream.Close()
+
+		w, mockUsage := streamChat(t, time.Second, upstream.URL)
+		assert.Equal(t, helloChunk+"data: [DONE]\n\n", w.Body.String())
+		if assert.Len(t, mockUsage.Records, 1) {
+			assert.False(t, mockUsage.Records[0].Partial)
+		}
+	})
+}
+
+func TestStreamResponse_LargeAndMultiLineEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// A tool call chunk larger than a default 64KB line buffer
+	args := strings.Repeat("a", 100*1024)
+	large := fmt.Sprintf("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"function\":{\"arguments\":%q}}]}}]}\n\n", args)
+	multiLine := "data: {\"choices\":[{\"delta\":\ndata: {\"content\":\"Hello\"}}]}\n\n"
+	stream := ": keepalive\n\n" + large + multiLine + "data: [DONE]\n\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, stream)
+	}))
+	defer upstream.Close()
+
+	w, mockUsage := streamChat(t, time.Second, upstream.URL)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, stream, w.Body.String(), "Events are passed through unchanged")
+	if assert.Len(t, mockUsage.Records, 1) {
+		assert.False(t, mockUsage.Records[0].Partial)
+	}
+}
+
+func TestForward_RetriesStreamsThatNeverStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var emptyHits, stalledHits atomic.Int32
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		emptyHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer empty.Close()
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stalledHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer stalled.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, helloChunk+"data: [DONE]\n\n")
+	}))
+	defer healthy.Close()
+
+	w, mockUsage := streamChat(t, 100*time.Millisecond, empty.URL, stalled.URL, healthy.URL)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, helloChunk+"data: [DONE]\n\n", w.Body.String(), "Nothing from the failed streams reaches the client")
+	assert.Equal(t, int32(1), emptyHits.Load())
+	assert.Equal(t, int32(1), stalledHits.Load())
+	if assert.Len(t, mockUsage.Records, 1) {
+		assert.False(t, mockUsage.Records[0].Partial)
+	}
+}
+
+func TestResponsesStreamEnd(t *testing.T) {
+	assert.True(t, responsesStreamEnd([]byte(`{"type":"response.completed","response":{}}`)))
+	assert.True(t, responsesStreamEnd([]byte(`{"type":"error","code":"server_error"}`)))
+	assert.False(t, responsesStreamEnd([]byte(`{"type":"response.output_text.delta","delta":"hi"}`)))
+	assert.False(t, responsesStreamEnd([]byte(`[DONE]`)))
+}
+
+func TestForward_RelaysStreamingClientErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	w, mockUsage := streamChat(t, 100*time.Millisecond, upstream.URL)
+	assert.Equal(t, http.StatusNotFound, w.Code, "The upstream's status reaches the client")
+	assert.Equal(t, int32(1), hits.Load(), "Client errors are not retried")
+	if assert.Len(t, mockUsage.Records, 1) {
+		assert.Zero(t, mockUsage.Records[0].OutputTokens)
+	}
+}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+// Gateway defaults for the timeouts a model does not set. Non-streaming
+// attempts are bounded by the handler's timeout (LLM_TIMEOUT) instead of a
+// first byte timeout; streams rely on the idle timeout and get a generous
+// total.
+const (
+	defaultDialTimeout         = 5 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultFirstByteTimeout    = 30 * time.Second
+	defaultStreamIdleTimeout   = 60 * time.Second
+	defaultStreamTotalTimeout  = 10 * time.Minute
+)
+
+// Phases of an upstream attempt that can time out. Each is reported as the
+// upstream_<phase>_timeout error code and in the llm_upstream_timeouts_total
+// metric.
+const (
+	phaseDial      = "dial"
+	phaseTLS       = "tls_handshake"
+	phaseFirstByte = "first_byte"
+	phaseIdle      = "idle"
+	phaseTotal     = "total"
+)
+
+// timeoutError is an upstream attempt that exceeded one of its timeouts.
+type timeoutError struct {
+	phase string
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("upstream %s timeout after %s", e.phase, e.after)
+}
+
+// code is the error code reported to the client.
+func (e *timeoutError) code() string {
+	return "upstream_" + e.phase + "_timeout"
+}
+
+// asTimeout returns the timeoutError in err's chain, if any.
+func asTimeout(err error) (*timeoutError, bool) {
+	var te *timeoutError
+	ok := errors.As(err, &te)
+	return te, ok
+}
+
+// timeouts bounds one upstream attempt. Zero disables a timeout.
+type timeouts struct {
+	dial, tlsHandshake, firstByte, idle, total time.Duration
+}
+
+// timeoutsFor returns the timeouts of an attempt against the model's
+// upstreams: the model's own where set, otherwise the gateway defaults.
+func (h *Handler) timeoutsFor(model *store.Model, stream bool) timeouts {
+	t := timeouts{
+		dial:         defaultDialTimeout,
+		tlsHandshake: defaultTLSHandshakeTimeout,
+		total:        h.timeout,
+	}
+	if stream {
+		t.firstByte = defaultFirstByteTimeout
+		t.idle = h.streamIdleTimeout
+		t.total = defaultStreamTotalTimeout
+	}
+
+	cfg := model.Timeouts
+	if cfg == nil {
+		return t
+	}
+	override := func(d *time.Duration, ms int) {
+		if ms > 0 {
+			*d = time.Duration(ms) * time.Millisecond
+		}
+	}
+	override(&t.dial, cfg.DialMs)
+	override(&t.tlsHandshake, cfg.TLSHandshakeMs)
+	override(&t.firstByte, cfg.FirstByteMs)
+	override(&t.idle, cfg.IdleMs)
+	override(&t.total, cfg.TotalMs)
+	return t
+}
+
+// bound derives the context of an attempt. A client trace starts the dial,
+// TLS handshake and first byte timers as each phase begins, and the total
+// timer starts now; whichever fires cancels the context with its
+// timeoutError as the cause. release stops the timers.
+func (t timeouts) bound(ctx context.Context) (bounded context.Context, release func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	var mu sync.Mutex
+	var released bool
+	timers := make(map[string]*time.Timer)
+	start := func(phase string, d time.Duration) {
+		if d <= 0 {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// Dials to several addresses share one timer
+		if _, ok := timers[phase]; !ok && !released {
+			timers[phase] = time.AfterFunc(d, func() { cancel(&timeoutError{phase: phase, after: d}) })
+		}
+	}
+	stop := func(phase string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer, ok := timers[phase]; ok {
+			timer.Stop()
+		}
+	}
+
+	start(phaseTotal, t.total)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		ConnectStart: func(string, string) { start(phaseDial, t.dial) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				stop(phaseDial)
+			}
+		},
+		TLSHandshakeStart:    func() { start(phaseTLS, t.tlsHandshake) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { stop(phaseTLS) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { start(phaseFirstByte, t.firstByte) },
+		GotFirstResponseByte: func() { stop(phaseFirstByte) },
+	})
+
+	return ctx, func() {
+		mu.Lock()
+		released = true
+		for _, timer := range timers {
+			timer.Stop()
+		}
+		mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// timeoutCause returns the timeout that ended ctx, if one did.
+func timeoutCause(ctx context.Context) (*timeoutError, bool) {
+	return asTimeout(context.Cause(ctx))
+}
+
+// boundedBody reports reads cut short by a timeout of the attempt as that
+// timeout rather than as a canceled context.
+type boundedBody struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (b *boundedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		if te, ok := timeoutCause(b.ctx); ok {
+			return n, te
+		}
+	}
+	return n, err
+}
+
+// upstreamTimeout is the error reported when every attempt of a request
+// timed out, coded by the phase of the last one.
+func upstreamTimeout(te *timeoutError) *openai.Error {
+	code := te.code()
+	return &openai.Error{
+		Message: fmt.Sprintf("The upstream provider timed out (%s).", strings.ReplaceAll(te.phase, "_", " ")),
+		Type:    "server_error",
+		Code:    &code,
+	}
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+)
+
+func TestTimeoutsFor(t *testing.T) {
+	h := NewHandler(store.NewMockRateLimitStore(), &store.MockModelStore{}, &store.MockUsageStore{}, 45*time.Second)
+
+	t.Run("Defaults", func(t *testing.T) {
+		model := &store.Model{ModelID: "gpt-4"}
+		assert.Equal(t, timeouts{dial: defaultDialTimeout, tlsHandshake: defaultTLSHandshakeTimeout, total: 45 * time.Second}, h.timeoutsFor(model, false))
+		assert.Equal(t, timeouts{
+			dial:         defaultDialTimeout,
+			tlsHandshake: defaultTLSHandshakeTimeout,
+			firstByte:    defaultFirstByteTimeout,
+			idle:         defaultStreamIdleTimeout,
+			total:        defaultStreamTotalTimeout,
+		}, h.timeoutsFor(model, true), "Streams are not cut off by the handler timeout")
+	})
+
+	t.Run("Model Overrides", func(t *testing.T) {
+		model := &store.Model{ModelID: "gpt-4", Timeouts: &store.TimeoutConfig{DialMs: 500, FirstByteMs: 2000, TotalMs: 90000}}
+		got := h.timeoutsFor(model, true)
+		assert.Equal(t, 500*time.Millisecond, got.dial)
+		assert.Equal(t, defaultTLSHandshakeTimeout, got.tlsHandshake)
+		assert.Equal(t, 2*time.Second, got.firstByte)
+		assert.Equal(t, defaultStreamIdleTimeout, got.idle)
+		assert.Equal(t, 90*time.Second, got.total)
+		assert.Equal(t, 2*time.Second, h.timeoutsFor(model, false).firstByte)
+	})
+}
+
+func TestTimeouts_Bound(t *testing.T) {
+	limits := timeouts{dial: 20 * time.Millisecond, firstByte: time.Hour}
+
+	t.Run("Phase Timeout Cancels With Cause", func(t *testing.T) {
+		ctx, release := limits.bound(context.Background())
+		defer release()
+		httptrace.ContextClientTrace(ctx).ConnectStart("tcp", "10.0.0.1:443")
+
+		<-ctx.Done()
+		te, ok := timeoutCause(ctx)
+		require.True(t, ok)
+		assert.Equal(t, "upstream_dial_timeout", te.code())
+		assert.True(t, isTimeout(te))
+	})
+
+	t.Run("Finished Phase Stops Its Timer", func(t *testing.T) {
+		ctx, release := limits.bound(context.Background())
+		defer release()
+		trace := httptrace.ContextClientTrace(ctx)
+		trace.ConnectStart("tcp", "10.0.0.1:443")
+		trace.ConnectDone("tcp", "10.0.0.1:443", nil)
+
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, ctx.Err())
+	})
+}
+
+func sendWithTimeouts(t *testing.T, model *store.Model, timeout time.Duration, stream bool) (*httptest.ResponseRecorder, *store.MockUsageStore) {
+	t.Helper()
+	mockUsage := &store.MockUsageStore{}
+	h := NewHandler(store.NewMockRateLimitStore(), &store.MockModelStore{Models: map[string]*store.Model{"gpt-4": model}}, mockUsage, timeout)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(fmt.Sprintf(`{"model": "gpt-4", "messages": [{"role": "user", "content": "hi"}], "stream": %t}`, stream)))
+	c.Request.Header.Set("X-LLM-Retry-Max", "0")
+	c.Set("tenant", &store.Tenant{TenantID: "t1", AllowedModels: []string{"*"}})
+
+	h.CreateCompletion(c)
+	require.NoError(t, h.Shutdown(context.Background()))
+	return w, mockUsage
+}
+
+func TestForward_Timeouts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	errorCode := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var resp openai.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Error)
+		require.NotNil(t, resp.Error.Code)
+		return *resp.Error.Code
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.Write([]byte(`{"choices":[{"message":{"content":"late"}}]}`))
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	t.Run("First Byte", func(t *testing.T) {
+		model := &store.Model{ModelID: "gpt-4", BaseURLs: []string{slow.URL}, Timeouts: &store.TimeoutConfig{FirstByteMs: 50}}
+		start := time.Now()
+		w, _ := sendWithTimeouts(t, model, 5*time.Second, true)
+
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Equal(t, "upstream_first_byte_timeout", errorCode(t, w))
+	})
+
+	t.Run("Total", func(t *testing.T) {
+		model := &store.Model{ModelID: "gpt-4", BaseURLs: []string{slow.URL}}
+		w, _ := sendWithTimeouts(t, model, 50*time.Millisecond, false)
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Equal(t, "upstream_total_timeout", errorCode(t, w))
+	})
+
+	t.Run("Long Stream Outlives Handler Timeout", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 4; i++ {
+				fmt.Fprint(w, helloChunk)
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+		defer upstream.Close()
+
+		model := &store.Model{ModelID: "gpt-4", BaseURLs: []string{upstream.URL}}
+		w, mockUsage := sendWithTimeouts(t, model, 100*time.Millisecond, true)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "data: [DONE]")
+		if assert.Len(t, mockUsage.Records, 1) {
+			assert.False(t, mockUsage.Records[0].Partial)
+		}
+	})
+
+	t.Run("Stream Total Interrupts", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for {
+				fmt.Fprint(w, helloChunk)
+				w.(http.Flusher).Flush()
+				select {
+				case <-time.After(20 * time.Millisecond):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}))
+		defer upstream.Close()
+
+		model := &store.Model{ModelID: "gpt-4", BaseURLs: []string{upstream.URL}, Timeouts: &store.TimeoutConfig{TotalMs: 150}}
+		w, mockUsage := sendWithTimeouts(t, model, 5*time.Second, true)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "(total_timeout)")
+		if assert.Len(t, mockUsage.Records, 1) {
+			assert.True(t, mockUsage.Records[0].Partial)
+		}
+	})
+}
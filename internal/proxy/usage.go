@@ -0,0 +1,370 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/user/llm-gateway/internal/openai"
+	"github.com/user/llm-gateway/internal/store"
+	"github.com/user/llm-gateway/internal/tokenizer"
+)
+
+// Usage is the token accounting for a single request.
+type Usage struct {
+	InputTokens     int
+	OutputTokens    int
+	CachedTokens    int
+	ReasoningTokens int
+	// Source is store.UsageSourceProvider or store.UsageSourceEstimated.
+	Source string
+	// Partial marks a stream that ended early; the tokens cover what the
+	// client received.
+	Partial bool
+}
+
+// openAIUsage is the usage object returned by OpenAI-compatible upstreams.
+type openAIUsage struct {
+	PromptTokens            int            `json:"prompt_tokens"`
+	CompletionTokens        int            `json:"completion_tokens"`
+	PromptTokensDetails     *inputDetails  `json:"prompt_tokens_details"`
+	CompletionTokensDetails *outputDetails `json:"completion_tokens_details"`
+}
+
+type inputDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type outputDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// resolveUsage prefers the provider-reported usage and falls back to the
+// tokenizer estimates when the upstream did not report any.
+func resolveUsage(reported *openAIUsage, estimatedIn, estimatedOut int) Usage {
+	if reported == nil {
+		return Usage{
+			InputTokens:  estimatedIn,
+			OutputTokens: estimatedOut,
+			Source:       store.UsageSourceEstimated,
+		}
+	}
+
+	u := Usage{
+		InputTokens:  reported.PromptTokens,
+		OutputTokens: reported.CompletionTokens,
+		Source:       store.UsageSourceProvider,
+	}
+	if reported.PromptTokensDetails != nil {
+		u.CachedTokens = reported.PromptTokensDetails.CachedTokens
+	}
+	if reported.CompletionTokensDetails != nil {
+		u.ReasoningTokens = reported.CompletionTokensDetails.ReasoningTokens
+	}
+	return u
+}
+
+// Image inputs are billed by resolution, which the gateway does not decode;
+// these are OpenAI's costs for a low-detail and a typical 1024px image.
+const (
+	lowDetailImageTokens  = 85
+	highDetailImageTokens = 765
+)
+
+// countPromptTokens counts message content plus the chat framing overhead,
+// tool calls and tool definitions.
+func countPromptTokens(tok tokenizer.Tokenizer, req *openai.ChatRequest) int {
+	total := tokenizer.TokensPerReply
+	for _, m := range req.Messages {
+		total += tokenizer.TokensPerMessage + tok.Count(m.Role) + tok.Count(m.Content.String())
+		if m.Name != "" {
+			total += tokenizer.TokensPerName + tok.Count(m.Name)
+		}
+		for _, part := range m.Content.Parts {
+			if part.Type != "image_url" || part.ImageURL == nil {
+				continue
+			}
+			if part.ImageURL.Detail == "low" {
+				total += lowDetailImageTokens
+			} else {
+				total += highDetailImageTokens
+			}
+		}
+		for _, call := range m.ToolCalls {
+			total += tok.Count(call.Function.Name) + tok.Count(call.Function.Arguments)
+		}
+	}
+	if len(req.Tools) > 0 {
+		// Definitions are injected into the prompt; their JSON is a close proxy
+		if defs, err := json.Marshal(req.Tools); err == nil {
+			total += tok.Count(string(defs))
+		}
+	}
+	return total
+}
+
+// responseFormat extracts generated text and usage from one API's
+// responses for token accounting.
+type responseFormat struct {
+	// streamEvent returns the generated text and usage carried by the data
+	// of one SSE event.
+	streamEvent func(data []byte) (string, *openAIUsage)
+	// streamEnd reports whether the data of an SSE event ends the stream.
+	streamEnd func(data []byte) bool
+	// streamError returns the SSE event telling the client the stream
+	// failed.
+	streamError func(code, message string) string
+	// parseBody counts the generated content of a non-streaming body and
+	// extracts its usage object, if any.
+	parseBody func(tok tokenizer.Tokenizer, body []byte) (int, *openAIUsage)
+}
+
+var (
+	chatFormat       = responseFormat{streamEvent: chatStreamEvent, streamEnd: isDone, streamError: chatStreamError, parseBody: parseCompletion}
+	completionFormat = responseFormat{streamEvent: completionStreamEvent, streamEnd: isDone, streamError: chatStreamError, parseBody: parseTextCompletion}
+	responsesFormat  = responseFormat{streamEvent: responsesStreamEvent, streamEnd: responsesStreamEnd, streamError: responsesStreamError, parseBody: parseResponse}
+)
+
+// chatOutput is the generated part of a chat message or streamed delta: its
+// text and the tool calls the model made.
+type chatOutput struct {
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// text returns everything generated, with tool calls counted like in
+// countPromptTokens.
+func (o chatOutput) text() string {
+	var text strings.Builder
+	text.WriteString(o.Content)
+	for _, call := range o.ToolCalls {
+		text.WriteString(call.Function.Name)
+		text.WriteString(call.Function.Arguments)
+	}
+	return text.String()
+}
+
+// parseCompletion counts the generated content of every choice of a
+// non-streaming response and extracts its usage object, if any. Bodies that
+// are not chat completions are counted as a whole.
+func parseCompletion(tok tokenizer.Tokenizer, body []byte) (int, *openAIUsage) {
+	var completion struct {
+		Choices []struct {
+			Message chatOutput `json:"message"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) == 0 {
+		return tok.Count(string(body)), nil
+	}
+
+	total := 0
+	for _, choice := range completion.Choices {
+		total += tok.Count(choice.Message.text())
+	}
+	return total, completion.Usage
+}
+
+// chatStreamEvent reads a chat.completion.chunk, with the deltas of every
+// choice. Deltas split tokens arbitrarily, so callers count the concatenated
+// text once at the end.
+func chatStreamEvent(data []byte) (string, *openAIUsage) {
+	var chunk struct {
+		Choices []struct {
+			Delta chatOutput `json:"delta"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", nil
+	}
+
+	var text strings.Builder
+	for _, choice := range chunk.Choices {
+		text.WriteString(choice.Delta.text())
+	}
+	return text.String(), chunk.Usage
+}
+
+// countCompletionPrompt counts the prompts of a legacy completion request;
+// pre-tokenized prompts count one token per ID. There is no chat framing.
+func countCompletionPrompt(tok tokenizer.Tokenizer, req *openai.CompletionRequest) int {
+	total := tok.Count(req.Suffix)
+	for _, text := range req.Prompt.Texts {
+		total += tok.Count(text)
+	}
+	for _, tokens := range req.Prompt.Tokens {
+		total += len(tokens)
+	}
+	return total
+}
+
+// parseTextCompletion is parseCompletion for legacy text_completion bodies.
+func parseTextCompletion(tok tokenizer.Tokenizer, body []byte) (int, *openAIUsage) {
+	var completion struct {
+		Choices []struct {
+			Text string `json:"text"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) == 0 {
+		return tok.Count(string(body)), nil
+	}
+
+	total := 0
+	for _, choice := range completion.Choices {
+		total += tok.Count(choice.Text)
+	}
+	return total, completion.Usage
+}
+
+func completionStreamEvent(data []byte) (string, *openAIUsage) {
+	var chunk struct {
+		Choices []struct {
+			Text string `json:"text"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", nil
+	}
+
+	var text strings.Builder
+	for _, choice := range chunk.Choices {
+		text.WriteString(choice.Text)
+	}
+	return text.String(), chunk.Usage
+}
+
+// responsesUsage is the usage object of the Responses API, which names its
+// fields after input and output rather than prompt and completion.
+type responsesUsage struct {
+	InputTokens         int            `json:"input_tokens"`
+	OutputTokens        int            `json:"output_tokens"`
+	InputTokensDetails  *inputDetails  `json:"input_tokens_details"`
+	OutputTokensDetails *outputDetails `json:"output_tokens_details"`
+}
+
+func (u *responsesUsage) toOpenAI() *openAIUsage {
+	if u == nil {
+		return nil
+	}
+	return &openAIUsage{
+		PromptTokens:            u.InputTokens,
+		CompletionTokens:        u.OutputTokens,
+		PromptTokensDetails:     u.InputTokensDetails,
+		CompletionTokensDetails: u.OutputTokensDetails,
+	}
+}
+
+// countResponsesInput counts the instructions and input items of a Responses
+// request, with the same per-message overhead as chat.
+func countResponsesInput(tok tokenizer.Tokenizer, req *openai.ResponsesRequest) int {
+	total := tokenizer.TokensPerReply + tok.Count(req.Instructions) + tok.Count(req.Input.Text)
+	for _, item := range req.Input.Items {
+		switch item.Type {
+		case "", "message":
+			total += tokenizer.TokensPerMessage + tok.Count(item.Role) + tok.Count(item.Content.String())
+			for _, part := range item.Content.Parts {
+				if part.Type != "input_image" {
+					continue
+				}
+				if part.Detail == "low" {
+					total += lowDetailImageTokens
+				} else {
+					total += highDetailImageTokens
+				}
+			}
+		case "function_call":
+			total += tok.Count(item.Name) + tok.Count(item.Arguments)
+		case "function_call_output":
+			total += tok.Count(item.OutputText())
+		}
+	}
+	for _, tool := range req.Tools {
+		total += tok.Count(string(tool))
+	}
+	return total
+}
+
+// responseOutput is the generated part of a Responses API response object.
+type responseOutput struct {
+	Output []struct {
+		Type      string `json:"type"`
+		Arguments string `json:"arguments"`
+		Content   []struct {
+			Text    string `json:"text"`
+			Refusal string `json:"refusal"`
+		} `json:"content"`
+	} `json:"output"`
+	Usage *responsesUsage `json:"usage"`
+}
+
+// parseResponse is parseCompletion for Responses API bodies.
+func parseResponse(tok tokenizer.Tokenizer, body []byte) (int, *openAIUsage) {
+	var resp responseOutput
+	if err := json.Unmarshal(body, &resp); err != nil || (resp.Output == nil && resp.Usage == nil) {
+		return tok.Count(string(body)), nil
+	}
+
+	total := 0
+	for _, item := range resp.Output {
+		total += tok.Count(item.Arguments)
+		for _, part := range item.Content {
+			total += tok.Count(part.Text) + tok.Count(part.Refusal)
+		}
+	}
+	return total, resp.Usage.toOpenAI()
+}
+
+// responsesStreamEvent reads a Responses API streaming event: text and
+// function argument deltas, and the usage of the final response.
+func responsesStreamEvent(data []byte) (string, *openAIUsage) {
+	var event struct {
+		Type     string          `json:"type"`
+		Delta    string          `json:"delta"`
+		Response *responseOutput `json:"response"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", nil
+	}
+	switch event.Type {
+	case "response.output_text.delta", "response.refusal.delta", "response.function_call_arguments.delta":
+		return event.Delta, nil
+	case "response.completed", "response.incomplete", "response.failed":
+		if event.Response != nil {
+			return "", event.Response.Usage.toOpenAI()
+		}
+	}
+	return "", nil
+}
+
+// countEmbeddingTokens counts the text inputs with the model's encoding;
+// pre-tokenized inputs count one token per ID. Embeddings have no framing
+// overhead.
+func countEmbeddingTokens(tok tokenizer.Tokenizer, req *openai.EmbeddingRequest) int {
+	total := 0
+	for _, text := range req.Input.Texts {
+		total += tok.Count(text)
+	}
+	for _, tokens := range req.Input.Tokens {
+		total += len(tokens)
+	}
+	return total
+}
+
+// parseEmbeddingUsage extracts the usage object of an embeddings response,
+// if any.
+func parseEmbeddingUsage(body []byte) *openAIUsage {
+	var embedding struct {
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &embedding); err != nil {
+		return nil
+	}
+	return embedding.Usage
+}
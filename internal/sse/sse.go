@@ -0,0 +1,145 @@
+// Package sse parses server-sent event streams (text/event-stream) as sent
+// by LLM providers.
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// MaxEventSize bounds a single event, so a runaway upstream cannot exhaust
+// memory. Tool call arguments and base64 content make events far larger
+// than a line buffer's usual 64KB.
+const MaxEventSize = 32 << 20
+
+// ErrEventTooLarge is returned for an event over MaxEventSize.
+var ErrEventTooLarge = errors.New("sse: event exceeds maximum size")
+
+// Event is one block of a stream, ended by a blank line.
+type Event struct {
+	// Type is the "event:" field. Empty means the default "message".
+	Type string
+	// Data joins the event's "data:" lines with "\n". It is nil when the
+	// block carries no data, e.g. a comment sent as a keepalive.
+	Data []byte
+	// ID is the last event ID: the most recent "id:" field in the stream.
+	ID string
+	// Raw is the block as received, with line endings normalized to "\n"
+	// and including the blank line that ended it, for passing the stream
+	// through unchanged.
+	Raw []byte
+}
+
+// Reader reads the events of a stream.
+type Reader struct {
+	scanner *bufio.Scanner
+	lastID  string
+}
+
+// NewReader returns a Reader parsing r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxEventSize)
+	scanner.Split(scanLines)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next block of the stream, including blocks without data
+// such as comments. At the end of the stream it returns io.EOF; a final
+// block not ended by a blank line is still returned first, since upstreams
+// that close abruptly often omit it. Read errors are returned as is.
+func (r *Reader) Next() (*Event, error) {
+	ev := &Event{}
+	var data [][]byte
+	for r.scanner.Scan() {
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			if len(ev.Raw) == 0 {
+				continue // Stray blank lines between events
+			}
+			ev.Raw = append(ev.Raw, '\n')
+			return r.dispatch(ev, data), nil
+		}
+		if len(ev.Raw)+len(line) >= MaxEventSize {
+			return nil, ErrEventTooLarge
+		}
+		ev.Raw = append(append(ev.Raw, line...), '\n')
+
+		field, value := parseField(line)
+		switch field {
+		case "data":
+			data = append(data, bytes.Clone(value))
+		case "event":
+			ev.Type = string(value)
+		case "id":
+			// IDs with NULL are ignored, per the spec
+			if bytes.IndexByte(value, 0) < 0 {
+				r.lastID = string(value)
+			}
+		}
+		// Comments (": ping"), "retry:" and unknown fields are only kept
+		// in Raw
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, ErrEventTooLarge
+		}
+		return nil, err
+	}
+	if len(ev.Raw) > 0 {
+		return r.dispatch(ev, data), nil
+	}
+	return nil, io.EOF
+}
+
+func (r *Reader) dispatch(ev *Event, data [][]byte) *Event {
+	ev.ID = r.lastID
+	if data != nil {
+		ev.Data = bytes.Join(data, []byte("\n"))
+	}
+	return ev
+}
+
+// parseField splits a line into its field name and value. A line starting
+// with a colon is a comment and has no field name; one without a colon is
+// a field with an empty value. A single space after the colon is dropped.
+func parseField(line []byte) (string, []byte) {
+	name, value, found := bytes.Cut(line, []byte(":"))
+	if !found {
+		return string(line), nil
+	}
+	if len(name) == 0 {
+		return "", nil
+	}
+	value, _ = bytes.CutPrefix(value, []byte(" "))
+	return string(name), value
+}
+
+// scanLines is a bufio.SplitFunc for SSE lines, which end in "\r\n", "\n"
+// or "\r".
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	i := bytes.IndexAny(data, "\r\n")
+	if i < 0 {
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+	if data[i] == '\n' {
+		return i + 1, data[:i], nil
+	}
+	// A "\r" may be the first half of "\r\n"
+	if i+1 < len(data) {
+		if data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return i + 1, data[:i], nil
+	}
+	return 0, nil, nil
+}
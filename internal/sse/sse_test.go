@@ -0,0 +1,106 @@
+package sse
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r io.Reader) ([]*Event, error) {
+	t.Helper()
+	reader := NewReader(r)
+	var events []*Event
+	for {
+		ev, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return events, nil
+			}
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestReader_Next(t *testing.T) {
+	t.Run("Fields", func(t *testing.T) {
+		stream := "event: response.created\nid: 1\ndata: {\"a\":1}\n\n" +
+			": ping\n\n" +
+			"data:{\"b\":2}\nretry: 1000\n\n"
+		events, err := readAll(t, strings.NewReader(stream))
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+
+		assert.Equal(t, "response.created", events[0].Type)
+		assert.Equal(t, "1", events[0].ID)
+		assert.Equal(t, `{"a":1}`, string(events[0].Data))
+		assert.Equal(t, "event: response.created\nid: 1\ndata: {\"a\":1}\n\n", string(events[0].Raw))
+
+		assert.Nil(t, events[1].Data, "Comments carry no data")
+		assert.Equal(t, ": ping\n\n", string(events[1].Raw))
+
+		assert.Equal(t, "", events[2].Type)
+		assert.Equal(t, "1", events[2].ID, "The last event ID carries over")
+		assert.Equal(t, `{"b":2}`, string(events[2].Data), "The space after the colon is optional")
+	})
+
+	t.Run("Multi-line Data", func(t *testing.T) {
+		events, err := readAll(t, strings.NewReader("data: {\ndata:  \"a\": 1\ndata: }\n\n"))
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "{\n \"a\": 1\n}", string(events[0].Data))
+	})
+
+	t.Run("Line Endings", func(t *testing.T) {
+		events, err := readAll(t, strings.NewReader("data: a\r\n\r\ndata: b\r\rdata: c\n\n"))
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		for i, want := range []string{"a", "b", "c"} {
+			assert.Equal(t, want, string(events[i].Data))
+			assert.Equal(t, "data: "+want+"\n\n", string(events[i].Raw))
+		}
+	})
+
+	t.Run("Byte By Byte", func(t *testing.T) {
+		events, err := readAll(t, iotest.OneByteReader(strings.NewReader("data: hello\r\n\r\ndata: [DONE]\r\n\r\n")))
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "hello", string(events[0].Data))
+		assert.Equal(t, "[DONE]", string(events[1].Data))
+	})
+
+	t.Run("Large Event", func(t *testing.T) {
+		payload := strings.Repeat("x", 1<<20)
+		events, err := readAll(t, strings.NewReader("data: "+payload+"\n\ndata: next\n\n"))
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, payload, string(events[0].Data))
+		assert.Equal(t, "next", string(events[1].Data))
+	})
+
+	t.Run("Oversized Event", func(t *testing.T) {
+		_, err := readAll(t, strings.NewReader("data: "+strings.Repeat("x", MaxEventSize)+"\n\n"))
+		assert.ErrorIs(t, err, ErrEventTooLarge)
+	})
+
+	t.Run("Unterminated Final Event", func(t *testing.T) {
+		events, err := readAll(t, strings.NewReader("data: a\n\ndata: b"))
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "b", string(events[1].Data))
+		assert.Equal(t, "data: b\n", string(events[1].Raw))
+	})
+
+	t.Run("Read Error", func(t *testing.T) {
+		broken := errors.New("connection reset")
+		events, err := readAll(t, io.MultiReader(strings.NewReader("data: a\n\ndata: b\n"), iotest.ErrReader(broken)))
+		assert.ErrorIs(t, err, broken)
+		require.Len(t, events, 1)
+		assert.Equal(t, "a", string(events[0].Data))
+	})
+}
@@ -21,6 +21,68 @@ type Tenant struct {
 	TPMLimit      int      `dynamodbav:"tpm_limit"`
 	AllowedModels []string `dynamodbav:"allowed_models"`
 	IsActive      bool     `dynamodbav:"is_active"`
+	// RetryPolicy bounds retries of the tenant's requests. Nil uses the
+	// gateway defaults.
+	RetryPolicy *RetryPolicy `dynamodbav:"retry_policy"`
+	// Hedging sends latency-sensitive requests to a second endpoint when
+	// the first is slow. Nil disables hedging.
+	Hedging *HedgingConfig `dynamodbav:"hedging"`
+	// ModelLimits overrides RPMLimit and TPMLimit per model. A model with
+	// an entry, or any model when there is a "*" entry, gets a budget of
+	// its own; other models share the tenant's.
+	ModelLimits map[string]ModelLimit `dynamodbav:"model_limits"`
+	// MaxConcurrent caps the tenant's in-flight requests, which RPM alone
+	// does not bound for long streams. Zero is unlimited.
+	MaxConcurrent int `dynamodbav:"max_concurrent"`
+}
+
+// ModelLimit is a tenant's limits for one model. Zero fields keep the
+// tenant's limit.
+type ModelLimit struct {
+	RPMLimit int `dynamodbav:"rpm_limit" json:"rpm_limit,omitempty"`
+	TPMLimit int `dynamodbav:"tpm_limit" json:"tpm_limit,omitempty"`
+}
+
+// RateLimits are the limits a request is held to and the budget it is
+// counted in.
+type RateLimits struct {
+	// Model names the model's own budget, or is empty for the tenant's
+	// shared one.
+	Model    string
+	RPMLimit int
+	TPMLimit int
+}
+
+// RateLimitsFor returns the limits for requests to model.
+func (t *Tenant) RateLimitsFor(model string) RateLimits {
+	limits := RateLimits{RPMLimit: t.RPMLimit, TPMLimit: t.TPMLimit}
+	override, ok := t.ModelLimits[model]
+	if !ok {
+		override, ok = t.ModelLimits["*"]
+	}
+	if !ok || model == "" {
+		return limits
+	}
+	limits.Model = model
+	if override.RPMLimit != 0 {
+		limits.RPMLimit = override.RPMLimit
+	}
+	if override.TPMLimit != 0 {
+		limits.TPMLimit = override.TPMLimit
+	}
+	return limits
+}
+
+// HedgingConfig tunes hedged requests: when an upstream has not sent
+// response headers within the model's recent latency percentile, the same
+// request goes to the next endpoint and the first good response wins.
+type HedgingConfig struct {
+	// Percentile of the model's recent times to first byte to wait before
+	// hedging, between 0 and 1 (default 0.95).
+	Percentile float64 `dynamodbav:"percentile" json:"percentile,omitempty"`
+	// MinDelayMs is the shortest wait before hedging, so fast models are
+	// not hedged on every request.
+	MinDelayMs int `dynamodbav:"min_delay_ms" json:"min_delay_ms,omitempty"`
 }
 
 type TenantStore interface {
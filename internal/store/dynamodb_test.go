@@ -0,0 +1,26 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant_RateLimitsFor(t *testing.T) {
+	tenant := &Tenant{
+		RPMLimit: 100,
+		TPMLimit: 100000,
+		ModelLimits: map[string]ModelLimit{
+			"gpt-4o": {RPMLimit: 50, TPMLimit: 200000},
+			"o1":     {TPMLimit: 20000},
+		},
+	}
+
+	assert.Equal(t, RateLimits{Model: "gpt-4o", RPMLimit: 50, TPMLimit: 200000}, tenant.RateLimitsFor("gpt-4o"))
+	assert.Equal(t, RateLimits{Model: "o1", RPMLimit: 100, TPMLimit: 20000}, tenant.RateLimitsFor("o1"), "Unset fields keep the tenant's limit")
+	assert.Equal(t, RateLimits{RPMLimit: 100, TPMLimit: 100000}, tenant.RateLimitsFor("gpt-3.5-turbo"), "Other models share the tenant's budget")
+
+	tenant.ModelLimits["*"] = ModelLimit{RPMLimit: 10}
+	assert.Equal(t, RateLimits{Model: "gpt-3.5-turbo", RPMLimit: 10, TPMLimit: 100000}, tenant.RateLimitsFor("gpt-3.5-turbo"), "A wildcard gives every model its own budget")
+	assert.Equal(t, RateLimits{RPMLimit: 100, TPMLimit: 100000}, tenant.RateLimitsFor(""))
+}
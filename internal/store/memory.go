@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryRateLimitStore is a RateLimitStore kept in process memory, with the
+// same GCRA semantics as RedisRateLimitStore. Limits are not shared between
+// gateway instances, so it suits tests and single-instance deployments.
+type MemoryRateLimitStore struct {
+	mu sync.Mutex
+	// tats holds each key's theoretical arrival time
+	tats map[string]time.Time
+	// slots holds each tenant's in-flight slots and their lease expiries
+	slots map[string]map[string]time.Time
+	// checks counts calls since expired keys were last swept
+	checks int
+	// now is the clock, replaceable in tests
+	now func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		tats:  make(map[string]time.Time),
+		slots: make(map[string]map[string]time.Time),
+		now:   time.Now,
+	}
+}
+
+func (s *MemoryRateLimitStore) AllowRequest(ctx context.Context, tenantID, model string, rpm int) (RateLimitResult, error) {
+	return s.gcra(rateLimitKey("rpm", tenantID, model), rpm, 1, false), nil
+}
+
+func (s *MemoryRateLimitStore) CheckTokens(ctx context.Context, tenantID, model string, tpm int) (RateLimitResult, error) {
+	return s.gcra(rateLimitKey("tpm", tenantID, model), tpm, 0, false), nil
+}
+
+func (s *MemoryRateLimitStore) ReserveTokens(ctx context.Context, tenantID, model string, tokens, tpm int) (RateLimitResult, error) {
+	return s.gcra(rateLimitKey("tpm", tenantID, model), tpm, tokens, false), nil
+}
+
+func (s *MemoryRateLimitStore) CommitTokens(ctx context.Context, tenantID, model string, reserved, used, tpm int) (RateLimitResult, error) {
+	return s.gcra(rateLimitKey("tpm", tenantID, model), tpm, used-reserved, true), nil
+}
+
+// AcquireSlot mirrors acquireSlotScript.
+func (s *MemoryRateLimitStore) AcquireSlot(ctx context.Context, tenantID, id string, limit int, lease time.Duration) (bool, error) {
+	if limit <= 0 {
+		return true, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	slots := s.slots[tenantID]
+	for slot, expiry := range slots {
+		if !expiry.After(now) {
+			delete(slots, slot)
+		}
+	}
+	if len(slots) >= limit {
+		return false, nil
+	}
+	if slots == nil {
+		slots = make(map[string]time.Time)
+		s.slots[tenantID] = slots
+	}
+	slots[id] = now.Add(lease)
+	return true, nil
+}
+
+func (s *MemoryRateLimitStore) RenewSlot(ctx context.Context, tenantID, id string, lease time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	expiry, ok := s.slots[tenantID][id]
+	if !ok || !expiry.After(now) {
+		return false, nil
+	}
+	s.slots[tenantID][id] = now.Add(lease)
+	return true, nil
+}
+
+func (s *MemoryRateLimitStore) ReleaseSlot(ctx context.Context, tenantID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.slots[tenantID], id)
+	if len(s.slots[tenantID]) == 0 {
+		delete(s.slots, tenantID)
+	}
+	return nil
+}
+
+// gcra mirrors gcraScript.
+func (s *MemoryRateLimitStore) gcra(key string, limit, cost int, force bool) RateLimitResult {
+	if limit <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	interval := RateLimitWindow / time.Duration(limit)
+	tat := s.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(time.Duration(cost) * interval)
+	result := RateLimitResult{
+		Allowed: !newTAT.Add(-RateLimitWindow).After(now),
+		Limit:   int64(limit),
+	}
+	if result.Allowed || force {
+		if newTAT.After(now) {
+			s.tats[key] = newTAT
+			tat = newTAT
+		} else {
+			// Refunds cannot bank quota beyond the limit
+			delete(s.tats, key)
+			tat = now
+		}
+	} else {
+		result.RetryAfter = newTAT.Add(-RateLimitWindow).Sub(now)
+	}
+
+	result.Remaining = max(int64(now.Add(RateLimitWindow).Sub(tat)/interval), 0)
+	result.Reset = max(tat.Sub(now), 0)
+	return result
+}
+
+// sweepEvery is how many checks pass between sweeps of expired keys.
+const sweepEvery = 1024
+
+// sweep periodically drops keys whose quota is fully replenished, which
+// behave the same as missing ones.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	s.checks++
+	if s.checks < sweepEvery {
+		return
+	}
+	s.checks = 0
+	for key, tat := range s.tats {
+		if !tat.After(now) {
+			delete(s.tats, key)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRateLimitStore() (*MemoryRateLimitStore, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	s := NewMemoryRateLimitStore()
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestMemoryRateLimitStore_AllowRequest(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestRateLimitStore()
+
+	for i := 0; i < 60; i++ {
+		r, _ := s.AllowRequest(ctx, "t1", "", 60)
+		assert.True(t, r.Allowed, "request %d", i)
+		assert.Equal(t, int64(59-i), r.Remaining)
+	}
+
+	r, _ := s.AllowRequest(ctx, "t1", "", 60)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, int64(0), r.Remaining)
+	assert.Equal(t, time.Second, r.RetryAfter, "One request frees up every second")
+	assert.Equal(t, time.Minute, r.Reset)
+
+	// Quota frees up gradually rather than all at a minute boundary
+	*now = now.Add(1500 * time.Millisecond)
+	r, _ = s.AllowRequest(ctx, "t1", "", 60)
+	assert.True(t, r.Allowed)
+	r, _ = s.AllowRequest(ctx, "t1", "", 60)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 500*time.Millisecond, r.RetryAfter)
+
+	r, _ = s.AllowRequest(ctx, "t2", "", 60)
+	assert.True(t, r.Allowed, "Tenants are limited separately")
+}
+
+func TestMemoryRateLimitStore_Tokens(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestRateLimitStore()
+
+	r, _ := s.CheckTokens(ctx, "t1", "", 1000)
+	assert.True(t, r.Allowed)
+	assert.Equal(t, int64(1000), r.Remaining)
+
+	r, _ = s.ReserveTokens(ctx, "t1", "", 400, 1000)
+	assert.True(t, r.Allowed)
+	assert.Equal(t, int64(600), r.Remaining)
+
+	r, _ = s.ReserveTokens(ctx, "t1", "", 700, 1000)
+	assert.False(t, r.Allowed, "Reservations must fit")
+	assert.Equal(t, int64(600), r.Remaining, "Denied reservations take nothing")
+	assert.Equal(t, 6*time.Second, r.RetryAfter)
+
+	// Usage beyond the reservation is charged even past the limit
+	r, _ = s.CommitTokens(ctx, "t1", "", 400, 1500, 1000)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, int64(0), r.Remaining)
+
+	r, _ = s.CheckTokens(ctx, "t1", "", 1000)
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 30*time.Second, r.RetryAfter, "The 500 tokens over the limit take 30s to free up")
+	assert.Equal(t, 90*time.Second, r.Reset)
+
+	*now = now.Add(30 * time.Second)
+	r, _ = s.CheckTokens(ctx, "t1", "", 1000)
+	assert.True(t, r.Allowed)
+	assert.Equal(t, int64(0), r.Remaining)
+}
+
+func TestMemoryRateLimitStore_ZeroLimit(t *testing.T) {
+	s, _ := newTestRateLimitStore()
+	for i := 0; i < 100; i++ {
+		r, _ := s.AllowRequest(context.Background(), "t1", "", 0)
+		assert.True(t, r.Allowed, "Zero is unlimited")
+	}
+}
+
+func TestMemoryRateLimitStore_Refund(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestRateLimitStore()
+
+	s.ReserveTokens(ctx, "t1", "", 800, 1000)
+	r, _ := s.CommitTokens(ctx, "t1", "", 800, 300, 1000)
+	assert.Equal(t, int64(700), r.Remaining, "Unused tokens are returned")
+
+	r, _ = s.CommitTokens(ctx, "t1", "", 300, 0, 1000)
+	assert.Equal(t, int64(1000), r.Remaining)
+	assert.Equal(t, time.Duration(0), r.Reset)
+
+	r, _ = s.CommitTokens(ctx, "t1", "", 500, 0, 1000)
+	assert.Equal(t, int64(1000), r.Remaining, "Refunds never add quota beyond the limit")
+}
+
+func TestMemoryRateLimitStore_ModelBudgets(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestRateLimitStore()
+
+	r, _ := s.ReserveTokens(ctx, "t1", "gpt-4o", 800, 1000)
+	assert.Equal(t, int64(200), r.Remaining)
+
+	r, _ = s.CheckTokens(ctx, "t1", "", 1000)
+	assert.Equal(t, int64(1000), r.Remaining, "A model's budget is separate from the tenant's")
+	r, _ = s.CheckTokens(ctx, "t1", "o1", 1000)
+	assert.Equal(t, int64(1000), r.Remaining, "And from other models'")
+}
+
+func TestMemoryRateLimitStore_Slots(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestRateLimitStore()
+	lease := 30 * time.Second
+
+	for _, id := range []string{"a", "b"} {
+		taken, _ := s.AcquireSlot(ctx, "t1", id, 2, lease)
+		assert.True(t, taken, id)
+	}
+	taken, _ := s.AcquireSlot(ctx, "t1", "c", 2, lease)
+	assert.False(t, taken, "Both slots are held")
+	taken, _ = s.AcquireSlot(ctx, "t2", "c", 2, lease)
+	assert.True(t, taken, "Tenants are limited separately")
+
+	require.NoError(t, s.ReleaseSlot(ctx, "t1", "a"))
+	taken, _ = s.AcquireSlot(ctx, "t1", "c", 2, lease)
+	assert.True(t, taken, "Released slots are free")
+
+	// "b" is renewed, "c" is left as if its instance crashed
+	*now = now.Add(20 * time.Second)
+	held, _ := s.RenewSlot(ctx, "t1", "b", lease)
+	assert.True(t, held)
+	*now = now.Add(20 * time.Second)
+	held, _ = s.RenewSlot(ctx, "t1", "c", lease)
+	assert.False(t, held, "Lapsed leases cannot be renewed")
+
+	taken, _ = s.AcquireSlot(ctx, "t1", "d", 2, lease)
+	assert.True(t, taken, "Lapsed slots are free")
+	taken, _ = s.AcquireSlot(ctx, "t1", "e", 2, lease)
+	assert.False(t, taken)
+
+	taken, _ = s.AcquireSlot(ctx, "t1", "f", 0, lease)
+	assert.True(t, taken, "Zero is unlimited")
+}
@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"errors"
+	"sort"
+	"sync"
+	"time"
 )
 
 // MockTenantStore
@@ -25,37 +28,61 @@ func (m *MockTenantStore) CreateTenant(ctx context.Context, tenant *Tenant) erro
 	return nil
 }
 
-// MockRateLimitStore
+// MockRateLimitStore is a MemoryRateLimitStore whose calls can be made to
+// fail
 type MockRateLimitStore struct {
-	RPM map[string]int64
-	TPM map[string]int64
+	*MemoryRateLimitStore
 	// Allow forcing errors for testing
 	Err error
 }
 
-func (m *MockRateLimitStore) IncrementRPM(ctx context.Context, tenantID string) (int64, error) {
+func (m *MockRateLimitStore) AllowRequest(ctx context.Context, tenantID, model string, rpm int) (RateLimitResult, error) {
 	if m.Err != nil {
-		return 0, m.Err
+		return RateLimitResult{}, m.Err
 	}
-	m.RPM[tenantID]++
-	return m.RPM[tenantID], nil
+	return m.MemoryRateLimitStore.AllowRequest(ctx, tenantID, model, rpm)
 }
 
-func (m *MockRateLimitStore) IncrementTPM(ctx context.Context, tenantID string, tokens int) (int64, error) {
+func (m *MockRateLimitStore) CheckTokens(ctx context.Context, tenantID, model string, tpm int) (RateLimitResult, error) {
 	if m.Err != nil {
-		return 0, m.Err
+		return RateLimitResult{}, m.Err
 	}
-	// Note: We don't have separate input/output maps here, just total per tenant
-	// If needed we can expand. For basic TPM limit test, this is enough.
-	m.TPM[tenantID] += int64(tokens)
-	return m.TPM[tenantID], nil
+	return m.MemoryRateLimitStore.CheckTokens(ctx, tenantID, model, tpm)
 }
 
-func (m *MockRateLimitStore) GetTPM(ctx context.Context, tenantID string) (int64, error) {
+func (m *MockRateLimitStore) ReserveTokens(ctx context.Context, tenantID, model string, tokens, tpm int) (RateLimitResult, error) {
 	if m.Err != nil {
-		return 0, m.Err
+		return RateLimitResult{}, m.Err
 	}
-	return m.TPM[tenantID], nil
+	return m.MemoryRateLimitStore.ReserveTokens(ctx, tenantID, model, tokens, tpm)
+}
+
+func (m *MockRateLimitStore) CommitTokens(ctx context.Context, tenantID, model string, reserved, used, tpm int) (RateLimitResult, error) {
+	if m.Err != nil {
+		return RateLimitResult{}, m.Err
+	}
+	return m.MemoryRateLimitStore.CommitTokens(ctx, tenantID, model, reserved, used, tpm)
+}
+
+func (m *MockRateLimitStore) AcquireSlot(ctx context.Context, tenantID, id string, limit int, lease time.Duration) (bool, error) {
+	if m.Err != nil {
+		return false, m.Err
+	}
+	return m.MemoryRateLimitStore.AcquireSlot(ctx, tenantID, id, limit, lease)
+}
+
+func (m *MockRateLimitStore) RenewSlot(ctx context.Context, tenantID, id string, lease time.Duration) (bool, error) {
+	if m.Err != nil {
+		return false, m.Err
+	}
+	return m.MemoryRateLimitStore.RenewSlot(ctx, tenantID, id, lease)
+}
+
+func (m *MockRateLimitStore) ReleaseSlot(ctx context.Context, tenantID, id string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	return m.MemoryRateLimitStore.ReleaseSlot(ctx, tenantID, id)
 }
 
 // Helper to easy init
@@ -64,18 +91,20 @@ func NewMockTenantStore() *MockTenantStore {
 }
 
 func NewMockRateLimitStore() *MockRateLimitStore {
-	return &MockRateLimitStore{
-		RPM: make(map[string]int64),
-		TPM: make(map[string]int64),
-	}
+	return &MockRateLimitStore{MemoryRateLimitStore: NewMemoryRateLimitStore()}
 }
 
 // MockUsageStore
 type MockUsageStore struct {
+	// mu guards Records against concurrent usage logs; read them once the
+	// handler has shut down
+	mu      sync.Mutex
 	Records []*UsageRecord
 }
 
 func (m *MockUsageStore) LogUsage(ctx context.Context, record *UsageRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.Records = append(m.Records, record)
 	return nil
 }
@@ -91,3 +120,12 @@ func (m *MockModelStore) GetModel(ctx context.Context, modelID string) (*Model,
 	}
 	return nil, errors.New("model not found")
 }
+
+func (m *MockModelStore) ListModels(ctx context.Context) ([]*Model, error) {
+	models := make([]*Model, 0, len(m.Models))
+	for _, model := range m.Models {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ModelID < models[j].ModelID })
+	return models, nil
+}
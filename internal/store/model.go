@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -12,19 +15,114 @@ import (
 )
 
 type Model struct {
-	ModelID      string   `dynamodbav:"model_id"`
+	ModelID string `dynamodbav:"model_id"`
+	// ProviderName selects the upstream API adapter ("openai", "azure",
+	// "anthropic", "gemini", "vertex", "bedrock").
+	// Empty is treated as OpenAI-compatible.
 	ProviderName string   `dynamodbav:"provider_name"`
 	BaseURLs     []string `dynamodbav:"base_urls"`
 	APIKeyEnv    string   `dynamodbav:"api_key_env"`
+	// UpstreamModel is the provider's model ID when it differs from ModelID
+	// (e.g. "claude-3-5-sonnet-20241022" for "claude-sonnet"). For Azure
+	// OpenAI it is the deployment name.
+	UpstreamModel string `dynamodbav:"upstream_model"`
+	// AuthStyle overrides how OpenAI-compatible upstreams receive the API key:
+	// "bearer", "api-key", "x-api-key" or "none". Defaults per provider.
+	AuthStyle string `dynamodbav:"auth_style"`
+	// URLTemplate builds the upstream URL from each base URL, with the
+	// {base_url}, {model}, {deployment} and {api_version} placeholders.
+	// Empty uses the base URL as is (Azure has a built-in default).
+	URLTemplate string `dynamodbav:"url_template"`
+	// APIVersion fills {api_version}, e.g. Azure's "2024-10-21".
+	APIVersion string `dynamodbav:"api_version"`
+	// Tokenizer names the BPE encoding used for usage accounting (e.g.
+	// "cl100k_base", "o200k_base"). Empty uses tokenizer.DefaultEncoding.
+	Tokenizer string `dynamodbav:"tokenizer"`
+	// Created is the Unix time the model was added, reported by /v1/models.
+	Created int64 `dynamodbav:"created"`
+	// LoadBalancing spreads requests over BaseURLs: "failover" (default, in
+	// order), "weighted_round_robin", "least_outstanding" or "latency".
+	LoadBalancing string `dynamodbav:"load_balancing"`
+	// Endpoints sets the weight and priority tier of base URLs, keyed by URL.
+	// Unlisted URLs have weight 1 and priority 0.
+	Endpoints map[string]EndpointConfig `dynamodbav:"endpoints"`
+	// CircuitBreaker tunes the breaker of each base URL. Nil uses defaults.
+	CircuitBreaker *BreakerConfig `dynamodbav:"circuit_breaker"`
+	// HealthCheck opts the model into active probing of each base URL. Nil
+	// does not probe.
+	HealthCheck *HealthCheckConfig `dynamodbav:"health_check"`
+	// Fallbacks are model IDs tried in order when every base URL of this
+	// model fails. Each must be in the tenant's allowed models and support
+	// the requested API; the fallbacks' own fallbacks are not followed.
+	Fallbacks []string `dynamodbav:"fallbacks"`
+	// RetryPolicy bounds retries of this model's upstreams. Where both the
+	// model and the tenant set a policy, the stricter value of each field
+	// applies.
+	RetryPolicy *RetryPolicy `dynamodbav:"retry_policy"`
+	// Timeouts bounds each request to this model's upstreams. Nil uses the
+	// gateway defaults.
+	Timeouts *TimeoutConfig `dynamodbav:"timeouts"`
+}
+
+// EndpointConfig sets how a base URL takes part in load balancing.
+type EndpointConfig struct {
+	// Weight is the URL's share of traffic within its tier.
+	Weight int `dynamodbav:"weight"`
+	// Priority is the URL's tier. Lower tiers are preferred and higher ones
+	// only serve when every URL before them fails or is unavailable.
+	Priority int `dynamodbav:"priority"`
+}
+
+// BreakerConfig tunes the circuit breakers of a model's endpoints. Zero
+// fields use the gateway defaults.
+type BreakerConfig struct {
+	// MinRequests is how many requests an interval needs before the failure
+	// ratio can trip the breaker.
+	MinRequests uint32 `dynamodbav:"min_requests"`
+	// FailureRatio trips the breaker when reached (0-1).
+	FailureRatio float64 `dynamodbav:"failure_ratio"`
+	// IntervalSeconds is how often a closed breaker resets its counts.
+	IntervalSeconds int `dynamodbav:"interval_seconds"`
+	// OpenSeconds is how long a tripped breaker rejects requests before
+	// letting probes through (half-open).
+	OpenSeconds int `dynamodbav:"open_seconds"`
+	// HalfOpenRequests is how many probes a half-open breaker allows.
+	HalfOpenRequests uint32 `dynamodbav:"half_open_requests"`
+}
+
+// TimeoutConfig bounds each attempt against a model's upstreams. Zero
+// fields use the gateway defaults.
+type TimeoutConfig struct {
+	// DialMs bounds opening the TCP connection.
+	DialMs int `dynamodbav:"dial_ms"`
+	// TLSHandshakeMs bounds the TLS handshake.
+	TLSHandshakeMs int `dynamodbav:"tls_handshake_ms"`
+	// FirstByteMs bounds the wait for response headers once the request is
+	// sent. Non-streaming upstreams only answer when generation is done, so
+	// by default it applies to streaming requests only.
+	FirstByteMs int `dynamodbav:"first_byte_ms"`
+	// IdleMs is how long a stream may go without sending data.
+	IdleMs int `dynamodbav:"idle_ms"`
+	// TotalMs bounds the whole attempt, including reading the body.
+	TotalMs int `dynamodbav:"total_ms"`
 }
 
 type ModelStore interface {
 	GetModel(ctx context.Context, modelID string) (*Model, error)
+	// ListModels returns every configured model, ordered by ModelID.
+	ListModels(ctx context.Context) ([]*Model, error)
 }
 
+// modelListTTL bounds how stale the cached model list may be.
+const modelListTTL = 5 * time.Minute
+
 type DynamoDBModelStore struct {
 	client    *dynamodb.Client
 	tableName string
+
+	mu            sync.RWMutex
+	models        []*Model
+	modelsExpires time.Time
 }
 
 func NewDynamoDBModelStore(ctx context.Context, region, tableName string) (*DynamoDBModelStore, error) {
@@ -62,3 +160,85 @@ func (s *DynamoDBModelStore) GetModel(ctx context.Context, modelID string) (*Mod
 
 	return &model, nil
 }
+
+func (s *DynamoDBModelStore) ListModels(ctx context.Context) ([]*Model, error) {
+	// 1. Check Cache
+	s.mu.RLock()
+	models, expiresAt := s.models, s.modelsExpires
+	s.mu.RUnlock()
+
+	if models != nil && time.Now().Before(expiresAt) {
+		return models, nil
+	}
+
+	// 2. Scan DynamoDB (the table holds one item per model, so it stays small)
+	models = []*Model{}
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan models from DynamoDB: %w", err)
+		}
+
+		var batch []*Model
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal models: %w", err)
+		}
+		models = append(models, batch...)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ModelID < models[j].ModelID })
+
+	// 3. Update Cache
+	s.mu.Lock()
+	s.models = models
+	s.modelsExpires = time.Now().Add(modelListTTL)
+	s.mu.Unlock()
+
+	return models, nil
+}
+
+// RetryPolicy bounds how failed upstream requests are retried. Zero fields
+// use the gateway defaults. The X-LLM-Retry-* request headers can make
+// retries less aggressive than the policy, never more.
+type RetryPolicy struct {
+	// MaxAttempts is the number of upstream attempts including the first
+	// (default 4, at most 11). 1 disables retries.
+	MaxAttempts int `dynamodbav:"max_attempts" json:"max_attempts,omitempty"`
+	// BaseBackoffMs is the backoff before the first retry, doubling for
+	// each further retry (default 100).
+	BaseBackoffMs int `dynamodbav:"base_backoff_ms" json:"base_backoff_ms,omitempty"`
+	// MaxBackoffMs caps the backoff between retries (default 10000).
+	MaxBackoffMs int `dynamodbav:"max_backoff_ms" json:"max_backoff_ms,omitempty"`
+	// RetryableStatuses are the upstream statuses that are retried
+	// (default 429 and every 5xx).
+	RetryableStatuses []int `dynamodbav:"retryable_statuses" json:"retryable_statuses,omitempty"`
+	// RetryOnTimeout retries attempts that timed out (default true).
+	RetryOnTimeout *bool `dynamodbav:"retry_on_timeout" json:"retry_on_timeout,omitempty"`
+}
+
+// HealthCheckConfig configures the active health probes of a model's base
+// URLs. Probes are unauthenticated, so Path must name an endpoint that
+// answers ExpectedStatus only when the upstream can serve; models without
+// both are not probed. Other zero fields use the gateway defaults.
+type HealthCheckConfig struct {
+	// Disabled turns probing off; the endpoints are then always healthy.
+	Disabled bool `dynamodbav:"disabled"`
+	// Path is the probed path. One starting with "/" replaces each base
+	// URL's path; any other is appended to it, e.g. "models" probes
+	// https://api.openai.com/v1/models for https://api.openai.com/v1.
+	Path string `dynamodbav:"path"`
+	// Method is the probe's HTTP method (default GET).
+	Method string `dynamodbav:"method"`
+	// ExpectedStatus is the status of a healthy probe.
+	ExpectedStatus int `dynamodbav:"expected_status"`
+	// TimeoutSeconds bounds each probe (default 5).
+	TimeoutSeconds int `dynamodbav:"timeout_seconds"`
+	// UnhealthyThreshold is how many consecutive failed probes mark an
+	// endpoint unhealthy (default 3).
+	UnhealthyThreshold int `dynamodbav:"unhealthy_threshold"`
+	// HealthyThreshold is how many consecutive successful probes mark an
+	// unhealthy endpoint healthy again (default 2).
+	HealthyThreshold int `dynamodbav:"healthy_threshold"`
+}
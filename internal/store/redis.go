@@ -8,13 +8,150 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// RateLimitWindow is the period tenant limits are expressed over (requests
+// and tokens per minute).
+const RateLimitWindow = time.Minute
+
+// RateLimitResult is the state of a tenant's limit after a check.
+type RateLimitResult struct {
+	// Allowed reports whether the request fits within the limit.
+	Allowed bool
+	// Limit is the quota per RateLimitWindow.
+	Limit int64
+	// Remaining is the quota that is usable right now.
+	Remaining int64
+	// Reset is how long until the full quota is available again.
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore enforces tenant limits over a sliding window, using GCRA
+// (the generic cell rate algorithm): usage is spread evenly over
+// RateLimitWindow, so quota frees up continuously instead of at minute
+// boundaries. A limit of zero or less is unlimited. Usage is counted in the
+// tenant's shared budget, or in a model's own when model is not empty (see
+// Tenant.RateLimitsFor).
 type RateLimitStore interface {
-	// IncrementRPM increments the request counter for the tenant and returns the new value.
-	IncrementRPM(ctx context.Context, tenantID string) (int64, error)
-	// IncrementTPM increments the token counter and returns the new value.
-	IncrementTPM(ctx context.Context, tenantID string, tokens int) (int64, error)
-	// GetTPM returns the current token count for the tenant.
-	GetTPM(ctx context.Context, tenantID string) (int64, error)
+	// AllowRequest counts a request against the tenant's requests per
+	// minute limit if it fits. Denied requests are not counted.
+	AllowRequest(ctx context.Context, tenantID, model string, rpm int) (RateLimitResult, error)
+	// CheckTokens reports whether the tenant has tokens per minute quota
+	// left, without using any.
+	CheckTokens(ctx context.Context, tenantID, model string, tpm int) (RateLimitResult, error)
+	// ReserveTokens takes tokens from the tenant's tokens per minute quota
+	// if they fit. Denied reservations take nothing.
+	ReserveTokens(ctx context.Context, tenantID, model string, tokens, tpm int) (RateLimitResult, error)
+	// CommitTokens settles a reservation once the request's usage is known:
+	// tokens used beyond the reservation are charged, even past the limit,
+	// and unused ones are returned. Committing zero used tokens refunds the
+	// reservation.
+	CommitTokens(ctx context.Context, tenantID, model string, reserved, used, tpm int) (RateLimitResult, error)
+
+	// AcquireSlot takes one of the tenant's limit in-flight request slots,
+	// named id, for lease if one is free. A slot whose lease lapses is
+	// freed, so instances that crash do not leak slots. A limit of zero or
+	// less is unlimited.
+	AcquireSlot(ctx context.Context, tenantID, id string, limit int, lease time.Duration) (bool, error)
+	// RenewSlot extends the lease of a slot that is still held, reporting
+	// whether it was.
+	RenewSlot(ctx context.Context, tenantID, id string, lease time.Duration) (bool, error)
+	// ReleaseSlot frees a slot.
+	ReleaseSlot(ctx context.Context, tenantID, id string) error
+}
+
+// gcraScript applies one GCRA check atomically. KEYS[1] holds the tenant's
+// theoretical arrival time (TAT) in Unix milliseconds. ARGV is the limit,
+// the window in milliseconds, the cost (negative to give quota back) and
+// whether to charge it even when over the limit ("1"). It returns allowed
+// (0/1), remaining, and the reset and retry-after times in milliseconds.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local force = ARGV[4] == "1"
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + tonumber(time[2]) / 1000
+local interval = window / limit
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + cost * interval
+local allowed = new_tat - window <= now
+local retry_after = 0
+if allowed or force then
+	if new_tat > now then
+		redis.call("SET", KEYS[1], new_tat, "PX", math.ceil(new_tat - now))
+		tat = new_tat
+	else
+		-- Refunds cannot bank quota beyond the limit
+		redis.call("DEL", KEYS[1])
+		tat = now
+	end
+else
+	retry_after = math.ceil(new_tat - window - now)
+end
+
+local remaining = math.floor((now + window - tat) / interval)
+if remaining < 0 then
+	remaining = 0
+end
+return {allowed and 1 or 0, remaining, math.ceil(tat - now), retry_after}
+`)
+
+// acquireSlotScript takes an in-flight slot atomically. KEYS[1] is a sorted
+// set of the tenant's slots scored by lease expiry in Unix milliseconds.
+// ARGV is the slot id, the limit and the lease in milliseconds. It returns 1
+// when the slot was taken.
+var acquireSlotScript = redis.NewScript(`
+redis.replicate_commands()
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local lease = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], now + lease, ARGV[1])
+-- Every lease is as long, so the set outlives all of its slots
+redis.call("PEXPIRE", KEYS[1], lease)
+return 1
+`)
+
+// renewSlotScript extends a held slot's lease. KEYS and ARGV are as for
+// acquireSlotScript, without the limit. It returns 1 when the slot was held.
+var renewSlotScript = redis.NewScript(`
+redis.replicate_commands()
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local lease = tonumber(ARGV[2])
+
+local expiry = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not expiry or tonumber(expiry) <= now then
+	return 0
+end
+redis.call("ZADD", KEYS[1], "XX", now + lease, ARGV[1])
+redis.call("PEXPIRE", KEYS[1], lease)
+return 1
+`)
+
+// rateLimitKey names the budget usage against a limit of kind ("rpm" or
+// "tpm") is counted in.
+func rateLimitKey(kind, tenantID, model string) string {
+	key := "rate_limit:" + kind + ":" + tenantID
+	if model != "" {
+		key += ":" + model
+	}
+	return key
 }
 
 type RedisRateLimitStore struct {
@@ -30,40 +167,64 @@ func NewRedisRateLimitStore(addr, password string) *RedisRateLimitStore {
 	}
 }
 
-func (s *RedisRateLimitStore) IncrementRPM(ctx context.Context, tenantID string) (int64, error) {
-	key := fmt.Sprintf("rate_limit:rpm:%s:%d", tenantID, time.Now().Unix()/60)
-	count, err := s.client.Incr(ctx, key).Result()
-	if err != nil {
-		return 0, err
-	}
+func (s *RedisRateLimitStore) AllowRequest(ctx context.Context, tenantID, model string, rpm int) (RateLimitResult, error) {
+	return s.gcra(ctx, rateLimitKey("rpm", tenantID, model), rpm, 1, false)
+}
 
-	if count == 1 {
-		s.client.Expire(ctx, key, 90*time.Second) // Expire after 90s to be safe
-	}
-	return count, nil
+func (s *RedisRateLimitStore) CheckTokens(ctx context.Context, tenantID, model string, tpm int) (RateLimitResult, error) {
+	return s.gcra(ctx, rateLimitKey("tpm", tenantID, model), tpm, 0, false)
 }
 
-func (s *RedisRateLimitStore) IncrementTPM(ctx context.Context, tenantID string, tokens int) (int64, error) {
-	key := fmt.Sprintf("rate_limit:tpm:%s:%d", tenantID, time.Now().Unix()/60)
-	count, err := s.client.IncrBy(ctx, key, int64(tokens)).Result()
-	if err != nil {
-		return 0, err
-	}
+func (s *RedisRateLimitStore) ReserveTokens(ctx context.Context, tenantID, model string, tokens, tpm int) (RateLimitResult, error) {
+	return s.gcra(ctx, rateLimitKey("tpm", tenantID, model), tpm, tokens, false)
+}
+
+func (s *RedisRateLimitStore) CommitTokens(ctx context.Context, tenantID, model string, reserved, used, tpm int) (RateLimitResult, error) {
+	return s.gcra(ctx, rateLimitKey("tpm", tenantID, model), tpm, used-reserved, true)
+}
 
-	if count == int64(tokens) {
-		s.client.Expire(ctx, key, 90*time.Second)
+func (s *RedisRateLimitStore) AcquireSlot(ctx context.Context, tenantID, id string, limit int, lease time.Duration) (bool, error) {
+	if limit <= 0 {
+		return true, nil
 	}
-	return count, nil
+	taken, err := acquireSlotScript.Run(ctx, s.client, []string{slotsKey(tenantID)}, id, limit, lease.Milliseconds()).Int()
+	return taken == 1, err
+}
+
+func (s *RedisRateLimitStore) RenewSlot(ctx context.Context, tenantID, id string, lease time.Duration) (bool, error) {
+	held, err := renewSlotScript.Run(ctx, s.client, []string{slotsKey(tenantID)}, id, lease.Milliseconds()).Int()
+	return held == 1, err
+}
+
+func (s *RedisRateLimitStore) ReleaseSlot(ctx context.Context, tenantID, id string) error {
+	return s.client.ZRem(ctx, slotsKey(tenantID), id).Err()
 }
 
-func (s *RedisRateLimitStore) GetTPM(ctx context.Context, tenantID string) (int64, error) {
-	key := fmt.Sprintf("rate_limit:tpm:%s:%d", tenantID, time.Now().Unix()/60)
-	val, err := s.client.Get(ctx, key).Int64()
-	if err == redis.Nil {
-		return 0, nil
+// slotsKey names the set of a tenant's in-flight request slots.
+func slotsKey(tenantID string) string {
+	return "rate_limit:concurrent:" + tenantID
+}
+
+func (s *RedisRateLimitStore) gcra(ctx context.Context, key string, limit, cost int, force bool) (RateLimitResult, error) {
+	if limit <= 0 {
+		return RateLimitResult{Allowed: true}, nil
 	}
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	vals, err := gcraScript.Run(ctx, s.client, []string{key}, limit, RateLimitWindow.Milliseconds(), cost, forceArg).Int64Slice()
 	if err != nil {
-		return 0, err
+		return RateLimitResult{}, err
+	}
+	if len(vals) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result: %v", vals)
 	}
-	return val, nil
+	return RateLimitResult{
+		Allowed:    vals[0] == 1,
+		Limit:      int64(limit),
+		Remaining:  vals[1],
+		Reset:      time.Duration(vals[2]) * time.Millisecond,
+		RetryAfter: time.Duration(vals[3]) * time.Millisecond,
+	}, nil
 }
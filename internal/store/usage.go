@@ -11,13 +11,24 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
+// Usage sources recorded on UsageRecord.UsageSource.
+const (
+	UsageSourceProvider  = "provider"  // Reported by the upstream in its response
+	UsageSourceEstimated = "estimated" // Counted by the gateway's tokenizer
+)
+
 type UsageRecord struct {
-	TenantID     string `dynamodbav:"tenant_id"`
-	Timestamp    string `dynamodbav:"timestamp"` // ISO8601
-	RequestID    string `dynamodbav:"request_id"`
-	ModelID      string `dynamodbav:"model_id"`
-	InputTokens  int    `dynamodbav:"input_tokens"`
-	OutputTokens int    `dynamodbav:"output_tokens"`
+	TenantID        string `dynamodbav:"tenant_id"`
+	Timestamp       string `dynamodbav:"timestamp"` // ISO8601
+	RequestID       string `dynamodbav:"request_id"`
+	ModelID         string `dynamodbav:"model_id"`
+	ServedModelID   string `dynamodbav:"served_model_id"` // ModelID or the fallback that answered
+	InputTokens     int    `dynamodbav:"input_tokens"`
+	OutputTokens    int    `dynamodbav:"output_tokens"`
+	CachedTokens    int    `dynamodbav:"cached_tokens"`
+	ReasoningTokens int    `dynamodbav:"reasoning_tokens"`
+	UsageSource     string `dynamodbav:"usage_source"`
+	Partial         bool   `dynamodbav:"partial"` // The stream was interrupted
 }
 
 type UsageStore interface {
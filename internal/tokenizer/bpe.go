@@ -0,0 +1,115 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/dlclark/regexp2"
+)
+
+// Pre-tokenization patterns for the tiktoken encodings. They rely on
+// lookahead, which is why regexp2 is used instead of the standard library.
+var patterns = map[string]string{
+	"cl100k_base": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	"o200k_base": `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	"p50k_base": `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
+	"r50k_base": `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
+}
+
+// BPE is a byte-pair-encoding tokenizer compatible with tiktoken vocabularies.
+type BPE struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp2.Regexp
+}
+
+// LoadBPE reads a tiktoken vocabulary ("<base64 token> <rank>" per line) for
+// one of the known encodings.
+func LoadBPE(name string, r io.Reader) (*BPE, error) {
+	expr, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	pattern, err := regexp2.Compile(expr, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile pattern for %s: %w", name, err)
+	}
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed vocab line %q", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode vocab token: %w", err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse vocab rank: %w", err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vocab: %w", err)
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("empty vocab for %s", name)
+	}
+
+	return &BPE{name: name, ranks: ranks, pattern: pattern}, nil
+}
+
+func (b *BPE) Name() string { return b.name }
+
+func (b *BPE) Count(text string) int {
+	count := 0
+	m, err := b.pattern.FindStringMatch(text)
+	for m != nil && err == nil {
+		piece := m.String()
+		if _, ok := b.ranks[piece]; ok {
+			count++
+		} else {
+			count += b.mergeCount([]byte(piece))
+		}
+		m, err = b.pattern.FindNextMatch(m)
+	}
+	return count
+}
+
+// mergeCount applies byte pair merges to piece, lowest rank first, and
+// returns the number of resulting tokens.
+func (b *BPE) mergeCount(piece []byte) int {
+	// bounds holds the start offset of every part plus the end of the piece.
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,100 @@
+package tokenizer
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultEncoding is used when a model does not name an encoding.
+const DefaultEncoding = "cl100k_base"
+
+// Per-message framing overhead used by OpenAI chat models. Every message is
+// wrapped as <|start|>{role}\n{content}<|end|>\n and the reply is primed with
+// <|start|>assistant<|message|>.
+const (
+	TokensPerMessage = 3
+	TokensPerName    = 1
+	TokensPerReply   = 3
+)
+
+// Tokenizer counts tokens for a specific encoding.
+type Tokenizer interface {
+	// Name returns the encoding name (e.g. "cl100k_base").
+	Name() string
+	// Count returns the number of tokens text encodes to.
+	Count(text string) int
+}
+
+// Estimator approximates token counts as one token per four bytes. It is used
+// when no vocabulary is available for an encoding.
+type Estimator struct{}
+
+func (Estimator) Name() string { return "estimate" }
+
+func (Estimator) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + 3) / 4
+}
+
+// Registry resolves encoding names to tokenizers, loading BPE vocabularies
+// lazily from <dir>/<encoding>.tiktoken.
+type Registry struct {
+	dir        string
+	mu         sync.Mutex
+	tokenizers map[string]Tokenizer
+}
+
+// NewRegistry creates a registry backed by the vocab files in dir. An empty
+// dir disables BPE loading and every lookup falls back to the Estimator.
+func NewRegistry(dir string) *Registry {
+	return &Registry{
+		dir:        dir,
+		tokenizers: make(map[string]Tokenizer),
+	}
+}
+
+// Register installs a tokenizer under name, replacing any loaded encoding.
+func (r *Registry) Register(name string, t Tokenizer) {
+	r.mu.Lock()
+	r.tokenizers[name] = t
+	r.mu.Unlock()
+}
+
+// Get returns the tokenizer for encoding. Encodings that cannot be loaded
+// resolve to the Estimator; the failure is logged once and cached.
+func (r *Registry) Get(encoding string) Tokenizer {
+	if encoding == "" {
+		encoding = DefaultEncoding
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tokenizers[encoding]; ok {
+		return t
+	}
+
+	var t Tokenizer = Estimator{}
+	if r.dir != "" {
+		path := filepath.Join(r.dir, encoding+".tiktoken")
+		f, err := os.Open(path)
+		if err == nil {
+			var bpe *BPE
+			bpe, err = LoadBPE(encoding, f)
+			f.Close()
+			if err == nil {
+				t = bpe
+			}
+		}
+		if err != nil {
+			slog.Warn("Failed to load tokenizer, falling back to estimate", "encoding", encoding, "path", path, "error", err)
+		}
+	}
+
+	r.tokenizers[encoding] = t
+	return t
+}
@@ -0,0 +1,81 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeVocab writes a tiny tiktoken vocab: every single byte plus the merges
+// needed to build "hello".
+func writeVocab(t *testing.T, dir, name string) {
+	var sb strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, tok := range []string{"he", "ll", "hell", "hello"} {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), 256+i)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".tiktoken"), []byte(sb.String()), 0o644))
+}
+
+func TestBPE_Count(t *testing.T) {
+	dir := t.TempDir()
+	writeVocab(t, dir, "cl100k_base")
+
+	f, err := os.Open(filepath.Join(dir, "cl100k_base.tiktoken"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	bpe, err := LoadBPE("cl100k_base", f)
+	require.NoError(t, err)
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},       // whole piece is a token
+		{"hell", 1},        // he + ll -> hell
+		{"helloo", 2},      // hello + o
+		{"hello world", 7}, // "hello" + " world" as 6 bytes
+		{"héllo", 5},       // h, two bytes of é, ll, o
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, bpe.Count(tt.text), tt.text)
+	}
+}
+
+func TestLoadBPE_Errors(t *testing.T) {
+	_, err := LoadBPE("unknown_base", strings.NewReader("YQ== 0\n"))
+	assert.Error(t, err)
+
+	_, err = LoadBPE("cl100k_base", strings.NewReader("not-a-vocab-line\n"))
+	assert.Error(t, err)
+
+	_, err = LoadBPE("cl100k_base", strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestRegistry_Get(t *testing.T) {
+	dir := t.TempDir()
+	writeVocab(t, dir, "o200k_base")
+	r := NewRegistry(dir)
+
+	tok := r.Get("o200k_base")
+	assert.Equal(t, "o200k_base", tok.Name())
+	assert.Same(t, tok, r.Get("o200k_base"), "Loaded encodings should be cached")
+
+	// Missing vocab falls back to the estimator
+	assert.Equal(t, "estimate", r.Get("").Name())
+	assert.Equal(t, 2, r.Get("cl100k_base").Count("hello"))
+
+	r.Register("cl100k_base", Estimator{})
+	assert.Equal(t, Estimator{}, r.Get("cl100k_base"))
+}
@@ -55,6 +55,15 @@ resource "aws_iam_role_policy" "task_policy" {
           aws_dynamodb_table.models.arn,
           aws_dynamodb_table.usage_logs.arn
         ]
+      },
+      {
+        # Bedrock models are invoked with SigV4 using this role
+        Action = [
+          "bedrock:InvokeModel",
+          "bedrock:InvokeModelWithResponseStream"
+        ]
+        Effect   = "Allow"
+        Resource = "*"
       }
     ]
   })